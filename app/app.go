@@ -1,13 +1,17 @@
 package app
 
 import (
-	"log"
+	"os"
+	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/mattn/go-isatty"
 	"github.com/abdfnx/tran/tools"
 	"github.com/abdfnx/tran/models"
 	"github.com/abdfnx/tran/constants"
 	"github.com/abdfnx/tran/internal/tui"
+	"github.com/abdfnx/tran/internal/config"
 	"github.com/abdfnx/gh/pkg/cmd/factory"
 )
 
@@ -21,22 +25,54 @@ var NewSendCmd = &cobra.Command{
 		err := tui.ValidateTranxAddress()
 
 		if err != nil {
-			log.Fatal(err)
+			return err
+		}
+
+		options := tranOptions(cmd)
+
+		if err := tools.MutuallyExclusive("specify only one of `--lan` or `--local-relay`", options.LAN, options.LocalRelay); err != nil {
+			return err
+		}
+
+		// the receiver that requested the files chose the tranx server and the password
+		if err := tools.MutuallyExclusive("specify only one of `--to`, `--lan`, `--local-relay` or `--code`",
+			options.To != "", options.LAN || options.LocalRelay || options.Password.Phrase != ""); err != nil {
+			return err
+		}
+
+		// every receiver of the files joins through the tranx server
+		if err := tools.MutuallyExclusive("specify only one of `--max-receivers`, `--to` or `--lan`",
+			options.MaxReceivers > 1, options.To != "" || options.LAN); err != nil {
+			return err
+		}
+
+		// the password of the receiver that requested the files expires on its own
+		if err := tools.MutuallyExclusive("specify only one of `--expires`, `--to` or `--lan`",
+			options.Expires != 0, options.To != "" || options.LAN); err != nil {
+			return err
+		}
+
+		if options.Expires != 0 && (options.Expires < time.Second || options.Expires > constants.MAX_CODE_EXPIRY) {
+			return &tools.FlagError{Err: fmt.Errorf("`--expires` must be between 1s and %s", constants.MAX_CODE_EXPIRY)}
+		}
+
+		if options.MaxReceivers < 1 || options.MaxReceivers > constants.MAX_RECEIVERS {
+			return &tools.FlagError{Err: fmt.Errorf("`--max-receivers` must be between 1 and %d", constants.MAX_RECEIVERS)}
 		}
 
-		tui.HandleSendCommand(models.TranOptions{
-			TranxAddress: constants.DEFAULT_ADDRESS,
-			TranxPort:    constants.DEFAULT_PORT,
-		}, args)
+		if err := checkOptions(options); err != nil {
+			return err
+		}
 
-		return nil
+		return tui.HandleSendCommand(options, args)
 	},
 }
 
 var NewReceiveCmd = &cobra.Command{
-	Use:   "receive",
+	Use:   "receive [password]",
 	Short: "Receive files/directories from remote",
-	Long:  "Receive files/directories from remote",
+	Long:  "Receive files/directories from remote, the password or link is asked for if it is not given",
+	Args:  cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		err := tui.ValidateTranxAddress()
 
@@ -44,15 +80,197 @@ var NewReceiveCmd = &cobra.Command{
 			return err
 		}
 
-		tui.HandleReceiveCommand(models.TranOptions{
-			TranxAddress: constants.DEFAULT_ADDRESS,
-			TranxPort:    constants.DEFAULT_PORT,
-		}, args[0])
+		options := tranOptions(cmd)
+
+		if err := checkOptions(options); err != nil {
+			return err
+		}
+
+		code, err := receiveCode(args)
+		if err != nil {
+			return err
+		}
+
+		return tui.HandleReceiveCommand(options, code)
+	},
+}
+
+var NewRequestCmd = &cobra.Command{
+	Use:   "request",
+	Short: "Request files/directories from remote",
+	Long:  "Request files/directories from remote, the sender sends them with `tran send --to <PASSWORD>`",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := tui.ValidateTranxAddress()
+
+		if err != nil {
+			return err
+		}
+
+		options := tranOptions(cmd)
+
+		if err := checkOptions(options); err != nil {
+			return err
+		}
 
-		return nil
+		return tui.HandleRequestCommand(options)
 	},
 }
 
+// receiveCode returns the password or link given as argument, or asks for it on a terminal.
+func receiveCode(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+
+	if !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+		return "", &tools.FlagError{Err: fmt.Errorf("specify the password or link to receive with")}
+	}
+
+	return tui.PromptCode()
+}
+
+func init() {
+	NewSendCmd.Flags().Bool("lan", false, "Announce the files on the local network instead of through the tranx server")
+	NewSendCmd.Flags().Bool("local-relay", false, "Serve an own tranx server and put its address into the password")
+	NewSendCmd.Flags().Bool("relay-only", false, "Transfer through the tranx server only, without direct connections")
+	NewSendCmd.Flags().String("proxy", "", "Connect to the tranx server through an HTTP CONNECT or SOCKS5 proxy, like socks5://host:1080")
+	NewSendCmd.Flags().String("code", "", "Use these words as password, after the number the tranx server assigns, like \"purple elephant dance\"")
+	NewSendCmd.Flags().String("to", "", "Send the files to the receiver that requested them, with the password it shows")
+	NewSendCmd.Flags().Duration("expires", 0, "Keep the password valid for this long, like 30m, instead of the 5 minutes of the tranx server")
+	NewSendCmd.Flags().Int("max-receivers", 1, "Send the files to up to this many receivers, which all use the same password")
+	NewSendCmd.Flags().Int("streams", 0, "Send over up to this many parallel connections when connected directly, chosen by the speed of the link if 0")
+	NewSendCmd.Flags().String("compression", "", "Compress the files with gzip, zstd or none, optionally at a level like zstd:19, or auto to skip compressing incompressible files")
+	NewSendCmd.Flags().String("note", "", "Show this note to the receiver along with the list of files")
+	NewReceiveCmd.Flags().Bool("lan", false, "Find the sender on the local network instead of through the tranx server")
+	NewReceiveCmd.Flags().Bool("relay-only", false, "Transfer through the tranx server only, without direct connections")
+	NewReceiveCmd.Flags().String("proxy", "", "Connect to the tranx server through an HTTP CONNECT or SOCKS5 proxy, like socks5://host:1080")
+	NewReceiveCmd.Flags().BoolP("yes", "y", false, "Accept the files without asking")
+	NewReceiveCmd.Flags().String("max-size", "", "Accept the files without asking if they are not larger than this, like 500MB")
+	NewReceiveCmd.Flags().Int("streams", 0, "Receive over up to this many parallel connections when connected directly, chosen by the speed of the link if 0")
+	NewReceiveCmd.Flags().StringArray("only", nil, "Receive only the files or directories matching this path or glob, like 'logs/*.txt', can be repeated")
+	NewRequestCmd.Flags().Bool("relay-only", false, "Transfer through the tranx server only, without direct connections")
+	NewRequestCmd.Flags().String("proxy", "", "Connect to the tranx server through an HTTP CONNECT or SOCKS5 proxy, like socks5://host:1080")
+	NewRequestCmd.Flags().String("code", "", "Use these words as password, after the number the tranx server assigns, like \"purple elephant dance\"")
+	NewRequestCmd.Flags().BoolP("yes", "y", false, "Accept the files without asking")
+	NewRequestCmd.Flags().String("max-size", "", "Accept the files without asking if they are not larger than this, like 500MB")
+	NewRequestCmd.Flags().Int("streams", 0, "Receive over up to this many parallel connections when connected directly, chosen by the speed of the link if 0")
+	NewRequestCmd.Flags().StringArray("only", nil, "Receive only the files or directories matching this path or glob, like 'logs/*.txt', can be repeated")
+}
+
+// tranOptions loads the tran config file and returns the transfer options configured in it, overridden by the flags.
+func tranOptions(cmd *cobra.Command) models.TranOptions {
+	config.LoadConfig(cmd.Flags().Lookup("start-dir"))
+	options := config.GetConfig().TranOptions()
+
+	if lan, err := cmd.Flags().GetBool("lan"); err == nil {
+		options.LAN = lan
+	}
+
+	if localRelay, err := cmd.Flags().GetBool("local-relay"); err == nil {
+		options.LocalRelay = localRelay
+	}
+
+	// the flag only turns direct connections off, the config may have done so already
+	if relayOnly, err := cmd.Flags().GetBool("relay-only"); err == nil && relayOnly {
+		options.Direct.Disabled = true
+	}
+
+	if proxy, err := cmd.Flags().GetString("proxy"); err == nil {
+		options.Proxy = proxy
+	}
+
+	if phrase, err := cmd.Flags().GetString("code"); err == nil {
+		options.Password.Phrase = phrase
+	}
+
+	if to, err := cmd.Flags().GetString("to"); err == nil {
+		options.To = to
+	}
+
+	if expires, err := cmd.Flags().GetDuration("expires"); err == nil {
+		options.Expires = expires
+	}
+
+	if maxReceivers, err := cmd.Flags().GetInt("max-receivers"); err == nil {
+		options.MaxReceivers = maxReceivers
+	}
+
+	if note, err := cmd.Flags().GetString("note"); err == nil {
+		options.Note = note
+	}
+
+	if yes, err := cmd.Flags().GetBool("yes"); err == nil {
+		options.Accept.All = yes
+	}
+
+	if maxSize, err := cmd.Flags().GetString("max-size"); err == nil && maxSize != "" {
+		options.Accept.MaxSize = maxSize
+	}
+
+	// zero leaves the number of streams as configured
+	if streams, err := cmd.Flags().GetInt("streams"); err == nil && streams != 0 {
+		options.Streams = streams
+	}
+
+	if compression, err := cmd.Flags().GetString("compression"); err == nil && compression != "" {
+		options.Compression = compression
+	}
+
+	if only, err := cmd.Flags().GetStringArray("only"); err == nil {
+		options.Only = only
+	}
+
+	return options
+}
+
+// checkOptions rejects transfer options that send and receive can not be run with.
+func checkOptions(options models.TranOptions) error {
+	if err := tools.MutuallyExclusive("specify only one of `--lan` or `--relay-only`", options.LAN, options.Direct.Disabled); err != nil {
+		return err
+	}
+
+	if options.Proxy != "" {
+		if _, err := tools.ParseProxy(options.Proxy); err != nil {
+			return &tools.FlagError{Err: err}
+		}
+	}
+
+	if options.Password.Phrase != "" {
+		if err := tools.ValidatePhrase(options.Password.Phrase); err != nil {
+			return &tools.FlagError{Err: fmt.Errorf("invalid `--code`: %w", err)}
+		}
+	}
+
+	if err := tools.ValidatePatterns(options.Only); err != nil {
+		return &tools.FlagError{Err: fmt.Errorf("invalid `--only`: %w", err)}
+	}
+
+	if options.Streams < 0 || options.Streams > constants.MAX_STREAMS {
+		return &tools.FlagError{Err: fmt.Errorf("`--streams` or streams in the config must be between 0 and %d", constants.MAX_STREAMS)}
+	}
+
+	if _, err := tools.ParseCompression(options.Compression); err != nil {
+		return &tools.FlagError{Err: fmt.Errorf("invalid `--compression` or compression in the config: %w", err)}
+	}
+
+	if _, err := options.Accept.MaxBytes(); err != nil {
+		return &tools.FlagError{Err: fmt.Errorf("invalid `--max-size` or accept.max_size in the config: %w", err)}
+	}
+
+	if err := tools.ValidatePasswordOptions(options.Password); err != nil {
+		return fmt.Errorf("invalid password options in the config: %w", err)
+	}
+
+	for _, relay := range options.Relays {
+		if _, _, err := tools.ParseRelay(relay); err != nil {
+			return fmt.Errorf("invalid tranx server in the relays of the config: %w", err)
+		}
+	}
+
+	return nil
+}
+
 var NewAuthCmd = Auth(factory.New())
 var NewGHConfigCmd = GHConfig(factory.New())
 var NewGHRepoCmd = Repo(factory.New())
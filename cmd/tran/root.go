@@ -105,6 +105,7 @@ func Execute(f *factory.Factory, version string, buildDate string) *cobra.Comman
 		app.NewAuthCmd,
 		app.NewSendCmd,
 		app.NewReceiveCmd,
+		app.NewRequestCmd,
 		app.NewGHConfigCmd,
 		app.NewGHRepoCmd,
 		app.Sync(),
@@ -18,6 +18,42 @@ const MAX_SEND_CHUNKS = 2e8
 
 const RECEIVER_CONNECT_TIMEOUT time.Duration = 5 * time.Minute
 
+// MAX_CODE_EXPIRY bounds how long a sender can keep its password valid.
+const MAX_CODE_EXPIRY time.Duration = 24 * time.Hour
+
+// RETIRED_CODE_RETENTION is how long tranx remembers used and expired passwords, to tell clients why they are rejected.
+const RETIRED_CODE_RETENTION time.Duration = 24 * time.Hour
+
+// MAX_RECEIVERS bounds the receivers a sender can send its payload to with the same password.
+const MAX_RECEIVERS = 100
+
+// MAX_STREAMS bounds the parallel connections a payload is sent over.
+const MAX_STREAMS = 16
+
+// STREAM_SEGMENT_BYTES is the size of the ranges of the payload, which the streams take one after the other.
+const STREAM_SEGMENT_BYTES = 16e6
+
+// AUTO_STREAMS_THROUGHPUT is the throughput in bytes per second of the first stream from which the receiver opens further streams.
+const AUTO_STREAMS_THROUGHPUT = 50e6
+
+// TRANSFER_WINDOW_BYTES bounds the bytes of the payload the sender sends ahead of the acknowledgements of the receiver.
+const TRANSFER_WINDOW_BYTES = 32e6
+
+// COMPRESSION_SAMPLE_BYTES and COMPRESSION_SAMPLE_FILES bound how much of the files the auto compression samples.
+const COMPRESSION_SAMPLE_BYTES = 128e3
+const COMPRESSION_SAMPLE_FILES = 64
+
+// MIN_COMPRESSION_SAVING is the part of the payload the auto compression has to save to compress the payload at all.
+const MIN_COMPRESSION_SAVING = 0.05
+
+// COMPRESSION_CHUNK_BYTES is the size of the chunks of the payload that are compressed in parallel, each on its own.
+const COMPRESSION_CHUNK_BYTES = 1e6
+
+// ZSTD_MAX_WINDOW_BYTES and ZSTD_MAX_MEMORY_BYTES bound the memory the receiver spends on decompressing a zstd payload.
+// The frames of the sender are as large as a chunk of the compression.
+const ZSTD_MAX_WINDOW_BYTES = 8 << 20
+const ZSTD_MAX_MEMORY_BYTES = 8 << 20
+
 const SEND_TEMP_FILE_NAME_PREFIX = "tran-send-tmp"
 const RECEIVE_TEMP_FILE_NAME_PREFIX = "tran-receive-tmp"
 
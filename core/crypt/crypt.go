@@ -2,6 +2,8 @@ package crypt
 
 import (
 	"fmt"
+	"sync"
+	"errors"
 	"crypto/aes"
 	"crypto/rand"
 	"crypto/cipher"
@@ -10,9 +12,17 @@ import (
 	"golang.org/x/crypto/pbkdf2"
 )
 
+// ErrVerification is returned when a message can not be decrypted, because it was corrupted or encrypted with another key.
+var ErrVerification = errors.New("message failed the integrity verification")
+
 type Crypt struct {
 	Key  []byte
 	Salt []byte
+
+	// the AEAD of the key is created on first use and shared by all messages of the session
+	once    sync.Once
+	gcm     cipher.AEAD
+	gcmErr  error
 }
 
 // New returns a new Crypt object, with a sha256 cryptographic key and corresponding salt.
@@ -42,50 +52,55 @@ func New(sessionkey []byte, salt ...[]byte) (*Crypt, error) {
 	return crypt, nil
 }
 
+// aead returns the AEAD of the key, it is created once and safe for concurrent use.
+func (s *Crypt) aead() (cipher.AEAD, error) {
+	s.once.Do(func() {
+		block, err := aes.NewCipher(s.Key)
+
+		if err != nil {
+			s.gcmErr = err
+			return
+		}
+
+		s.gcm, s.gcmErr = cipher.NewGCM(block)
+	})
+
+	return s.gcm, s.gcmErr
+}
+
 // Encrypt encrypts the provided message using shared key and a random nonce that is appended to the message.
 func (s *Crypt) Encrypt(unencrypted []byte) (encrypted []byte, err error) {
-	block, err := aes.NewCipher(s.Key)
+	aescgm, err := s.aead()
 
 	if err != nil {
 		return nil, err
 	}
 
-	nonce := make([]byte, 12)
+	nonce := make([]byte, 12, 12 + len(unencrypted) + aescgm.Overhead())
 
 	if _, err := rand.Read(nonce); err != nil {
 		return nil, fmt.Errorf("unable to generate random nonce: %v", err)
 	}
 
-	aescgm, err := cipher.NewGCM(block)
-
-	if err != nil {
-		return nil, err
-	}
-
-	encrypted = aescgm.Seal(nil, nonce, unencrypted, nil)
-	encrypted = append(nonce, encrypted...)
-
-	return encrypted, nil
+	return aescgm.Seal(nonce, nonce, unencrypted, nil), nil
 }
 
 // Decrypt decrypts the provided message with the the shared key.
 func (s *Crypt) Decrypt(encrypted []byte) (decrypted []byte, err error) {
-	block, err := aes.NewCipher(s.Key)
+	aescgm, err := s.aead()
 
 	if err != nil {
 		return nil, err
 	}
 
-	aescgm, err := cipher.NewGCM(block)
-
-	if err != nil {
-		return nil, err
+	if len(encrypted) < 12 {
+		return nil, ErrVerification
 	}
 
 	decrypted, err = aescgm.Open(nil, encrypted[:12], encrypted[12:], nil)
 
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %s", ErrVerification, err)
 	}
 
 	return decrypted, nil
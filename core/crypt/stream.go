@@ -0,0 +1,76 @@
+package crypt
+
+import (
+	"fmt"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// Cipher encrypts and decrypts the messages of a connection.
+type Cipher interface {
+	Encrypt(unencrypted []byte) ([]byte, error)
+	Decrypt(encrypted []byte) ([]byte, error)
+}
+
+// Stream encrypts the messages of one of the parallel streams of a transfer, in one direction each.
+// Its nonces are the number of the stream followed by a counter of the messages, so the streams never share a nonce
+// and messages can neither be replayed, reordered nor moved to another stream.
+type Stream struct {
+	aead     cipher.AEAD
+	id       uint32
+	sent     uint64
+	received uint64
+}
+
+// Stream returns the cipher of stream id, both clients of a transfer derive the same one from the shared key.
+func (s *Crypt) Stream(id uint32) (*Stream, error) {
+	// the streams use a key of their own, so their nonces never meet the random ones of Encrypt
+	key := sha256.Sum256(append([]byte("tran stream "), s.Key...))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stream{aead: aead, id: id}, nil
+}
+
+func (s *Stream) nonce(counter uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint32(nonce, s.id)
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+
+	return nonce
+}
+
+// Encrypt encrypts the next message of the stream, the nonce is prepended to the message like Crypt.Encrypt does.
+func (s *Stream) Encrypt(unencrypted []byte) ([]byte, error) {
+	nonce := s.nonce(s.sent)
+	s.sent++
+
+	return s.aead.Seal(nonce, nonce, unencrypted, nil), nil
+}
+
+// Decrypt decrypts the next message of the stream, a message that is not the next one fails the verification.
+func (s *Stream) Decrypt(encrypted []byte) ([]byte, error) {
+	if len(encrypted) < 12 || !bytes.Equal(encrypted[:12], s.nonce(s.received)) {
+		return nil, ErrVerification
+	}
+
+	decrypted, err := s.aead.Open(nil, encrypted[:12], encrypted[12:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrVerification, err)
+	}
+
+	s.received++
+
+	return decrypted, nil
+}
@@ -0,0 +1,132 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// streamPair returns the ciphers of stream id of both clients of a transfer.
+func streamPair(t *testing.T, id uint32) (*Stream, *Stream) {
+	sessionKey := []byte("the session key of the transfer")
+
+	senderCrypt, err := New(sessionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receiverCrypt, err := New(sessionKey, senderCrypt.Salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sending, err := senderCrypt.Stream(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receiving, err := receiverCrypt.Stream(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sending, receiving
+}
+
+// encrypt encrypts the messages in order.
+func encrypt(t *testing.T, stream *Stream, messages ...string) [][]byte {
+	var encrypted [][]byte
+
+	for _, message := range messages {
+		enc, err := stream.Encrypt([]byte(message))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encrypted = append(encrypted, enc)
+	}
+
+	return encrypted
+}
+
+func expectVerificationError(t *testing.T, what string, stream *Stream, encrypted []byte) {
+	if _, err := stream.Decrypt(encrypted); !errors.Is(err, ErrVerification) {
+		t.Errorf("%s: got %v, want %v", what, err, ErrVerification)
+	}
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	sending, receiving := streamPair(t, 3)
+
+	for i, enc := range encrypt(t, sending, "first", "second", "third") {
+		dec, err := receiving.Decrypt(enc)
+		if err != nil || string(dec) != []string{"first", "second", "third"}[i] {
+			t.Fatalf("message %d: got %q, %v", i, dec, err)
+		}
+	}
+}
+
+func TestStreamRejectsReusedNonces(t *testing.T) {
+	sending, receiving := streamPair(t, 1)
+	messages := encrypt(t, sending, "first", "second")
+
+	if _, err := receiving.Decrypt(messages[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	expectVerificationError(t, "replayed message", receiving, messages[0])
+
+	// a message encrypted again under the nonce of the first one
+	replayed := append([]byte{}, messages[1]...)
+	copy(replayed, messages[0][:12])
+	expectVerificationError(t, "reused nonce", receiving, replayed)
+
+	// the stream still accepts the message it expects
+	if dec, err := receiving.Decrypt(messages[1]); err != nil || string(dec) != "second" {
+		t.Errorf("got %q, %v, want the second message", dec, err)
+	}
+}
+
+func TestStreamRejectsWrongNonces(t *testing.T) {
+	sending, receiving := streamPair(t, 1)
+	messages := encrypt(t, sending, "first", "second")
+
+	expectVerificationError(t, "skipped message", receiving, messages[1])
+
+	otherSending, _ := streamPair(t, 2)
+	expectVerificationError(t, "message of another stream", receiving, encrypt(t, otherSending, "first")[0])
+
+	tampered := append([]byte{}, messages[0]...)
+	tampered[len(tampered)-1] ^= 1
+	expectVerificationError(t, "tampered message", receiving, tampered)
+
+	// the nonce of the next message with the content of another one
+	moved := append(append([]byte{}, messages[0][:12]...), encrypt(t, otherSending, "second")[0][12:]...)
+	expectVerificationError(t, "moved message", receiving, moved)
+
+	expectVerificationError(t, "short message", receiving, messages[0][:8])
+
+	if dec, err := receiving.Decrypt(messages[0]); err != nil || !bytes.Equal(dec, []byte("first")) {
+		t.Errorf("got %q, %v, want the first message", dec, err)
+	}
+}
+
+func TestStreamRejectsMessagesOfTheSession(t *testing.T) {
+	senderCrypt, err := New([]byte("the session key of the transfer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receiving, err := senderCrypt.Stream(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the random nonces of Encrypt never pass as a nonce of a stream
+	enc, err := senderCrypt.Encrypt([]byte("control message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectVerificationError(t, "message of the session", receiving, enc)
+}
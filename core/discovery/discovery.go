@@ -0,0 +1,125 @@
+// Package discovery finds the sender of a password on the local network, so transfers work without a tranx server.
+//
+// The sender announces an identifier derived from its password over UDP multicast and broadcast,
+// the receiver derives the same identifier and waits for its announcement.
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"time"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"crypto/sha256"
+
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// GroupAddress is the multicast group announcements are sent to, they are broadcast on the same port as well.
+	GroupAddress = "239.255.84.82:9371"
+
+	announceInterval    = 500 * time.Millisecond
+	maxAnnouncementSize = 512
+	idIterations        = 100000
+)
+
+// announcement is the packet announcing a sender.
+type announcement struct {
+	ID   string `json:"id"`
+	Port int    `json:"port"`
+}
+
+// ID derives the identifier announced by the sender of password.
+// The derivation is slow on purpose, so the password can not be guessed cheaply from an overheard announcement.
+func ID(password models.Password) string {
+	key := pbkdf2.Key([]byte(password), []byte("tran-lan-discovery"), idIterations, 16, sha256.New)
+
+	return hex.EncodeToString(key)
+}
+
+// Announce announces that the sender with id accepts connections on port until ctx is done, it always returns an error.
+func Announce(ctx context.Context, id string, port int) error {
+	group, err := net.ResolveUDPAddr("udp4", GroupAddress)
+	if err != nil {
+		return err
+	}
+
+	broadcast := &net.UDPAddr{IP: net.IPv4bcast, Port: group.Port}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	packet, err := json.Marshal(announcement{ID: id, Port: port})
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(announceInterval)
+	defer ticker.Stop()
+
+	for {
+		// networks may drop either of them, only fail if both can not be sent
+		_, groupErr := conn.WriteToUDP(packet, group)
+		_, broadcastErr := conn.WriteToUDP(packet, broadcast)
+
+		if groupErr != nil && broadcastErr != nil {
+			return fmt.Errorf("could not announce the sender: %w", groupErr)
+		}
+
+		select {
+			case <-ctx.Done():
+				return ctx.Err()
+
+			case <-ticker.C:
+		}
+	}
+}
+
+// Lookup waits until the sender with id is announced and returns the address it accepts connections on.
+func Lookup(ctx context.Context, id string) (*net.TCPAddr, error) {
+	group, err := net.ResolveUDPAddr("udp4", GroupAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	stop := tools.OnDone(ctx, func() {
+		conn.Close()
+	})
+
+	defer stop()
+
+	buffer := make([]byte, maxAnnouncementSize)
+
+	for {
+		n, addr, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			return nil, err
+		}
+
+		received := announcement{}
+		if err := json.Unmarshal(buffer[:n], &received); err != nil || received.ID != id {
+			continue
+		}
+
+		return &net.TCPAddr{IP: addr.IP, Port: received.Port}, nil
+	}
+}
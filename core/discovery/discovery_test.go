@@ -0,0 +1,66 @@
+package discovery
+
+import (
+	"net"
+	"time"
+	"context"
+	"testing"
+)
+
+// requireMulticast skips the test if the host can not join the multicast group of the announcements.
+func requireMulticast(t *testing.T) {
+	group, err := net.ResolveUDPAddr("udp4", GroupAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		t.Skipf("multicast is not available: %v", err)
+	}
+
+	conn.Close()
+}
+
+func TestID(t *testing.T) {
+	if ID("7-alpha-beta-gamma") != ID("7-alpha-beta-gamma") {
+		t.Error("the identifier of a password changed")
+	}
+
+	if ID("7-alpha-beta-gamma") == ID("8-alpha-beta-gamma") {
+		t.Error("two passwords have the same identifier")
+	}
+}
+
+func TestLookupFindsTheAnnouncedSender(t *testing.T) {
+	requireMulticast(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
+	defer cancel()
+
+	id := ID("7-alpha-beta-gamma")
+
+	// the announcements of other senders are ignored
+	go Announce(ctx, ID("8-delta-epsilon-zeta"), 1111)
+	go Announce(ctx, id, 2222)
+
+	addr, err := Lookup(ctx, id)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+
+	if addr.Port != 2222 {
+		t.Errorf("found the sender on port %d, want 2222", addr.Port)
+	}
+}
+
+func TestLookupStopsWithTheContext(t *testing.T) {
+	requireMulticast(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200 * time.Millisecond)
+	defer cancel()
+
+	if _, err := Lookup(ctx, ID("9-no-such-sender")); err != context.DeadlineExceeded {
+		t.Errorf("Lookup without a sender returned %v, want the deadline to be exceeded", err)
+	}
+}
@@ -0,0 +1,68 @@
+package receiver
+
+import (
+	"fmt"
+	"context"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models"
+	"github.com/abdfnx/tran/core/discovery"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// ConnectLAN finds the sender of the password on the local network and establishes the connection with it,
+// the payload is transferred over the returned connection without a tranx server.
+func (r *Receiver) ConnectLAN(ctx context.Context, password models.Password) (*websocket.Conn, error) {
+	// wait for the announcement of the sender
+	r.phase = protocol.PhaseRendezvous
+	lookupCtx, cancel := tools.WithTimeout(ctx, r.timeouts.Of(protocol.PhaseRendezvous))
+	senderAddr, err := discovery.Lookup(lookupCtx, discovery.ID(password))
+	cancel()
+
+	if err != nil {
+		return nil, r.phaseError(ctx, err)
+	}
+
+	r.phase = protocol.PhaseConnect
+	dialCtx, cancel := tools.WithTimeout(ctx, r.timeouts.Of(protocol.PhaseConnect))
+	wsConn, _, err := websocket.DefaultDialer.DialContext(dialCtx, fmt.Sprintf("ws://%s/establish-receiver", senderAddr), nil)
+	cancel()
+
+	if err != nil {
+		return nil, r.phaseError(ctx, err)
+	}
+
+	stop := r.abortOnDone(ctx, wsConn)
+	defer stop()
+
+	err = r.negotiateLAN(wsConn, password)
+	if err != nil {
+		err = r.phaseError(ctx, err)
+		if ctx.Err() == nil {
+			r.abort(wsConn, err)
+		}
+
+		wsConn.Close()
+
+		return nil, err
+	}
+
+	return wsConn, nil
+}
+
+// negotiateLAN does the key exchange and handshake with a sender that was connected to directly.
+func (r *Receiver) negotiateLAN(wsConn *websocket.Conn, password models.Password) error {
+	// the sender may be anyone who announced the identifier, it learns nothing about the password before the key exchange
+	err := r.establishSecureConnection(wsConn, password, "", false)
+	if err != nil {
+		return err
+	}
+
+	if _, err = r.doTransferHandshake(wsConn); err != nil {
+		return err
+	}
+
+	// the connection is direct already
+	return r.keepConnection(wsConn)
+}
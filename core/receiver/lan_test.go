@@ -0,0 +1,85 @@
+package receiver
+
+import (
+	"net"
+	"time"
+	"context"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/models"
+	"github.com/abdfnx/tran/core/discovery"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// An impostor can announce the identifier it overheard, the receiver must not tell it anything to guess the password from.
+func TestConnectLANRevealsNoPasswordToImpostors(t *testing.T) {
+	group, err := net.ResolveUDPAddr("udp4", discovery.GroupAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conn, err := net.ListenMulticastUDP("udp4", nil, group); err != nil {
+		t.Skipf("multicast is not available: %v", err)
+	} else {
+		conn.Close()
+	}
+
+	password := models.Password("7-alpha-beta-gamma")
+	established := make(chan protocol.PasswordPayload, 1)
+	upgrader := websocket.Upgrader{}
+
+	impostor := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer wsConn.Close()
+
+		msg := protocol.TranxMessage{}
+		if err := wsConn.ReadJSON(&msg); err != nil {
+			return
+		}
+
+		payload := protocol.PasswordPayload{}
+		if bytes, ok := msg.Payload.(map[string]interface{}); ok {
+			payload.Password, _ = bytes["password"].(string)
+		}
+
+		established <- payload
+	}))
+
+	// the receiver dials the address the announcement came from, which is not the loopback one
+	listener, err := net.Listen("tcp4", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	impostor.Listener.Close()
+	impostor.Listener = listener
+	impostor.Start()
+	defer impostor.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
+	defer cancel()
+
+	go discovery.Announce(ctx, discovery.ID(password), impostor.Listener.Addr().(*net.TCPAddr).Port)
+
+	r := NewReceiver(models.TranOptions{})
+	if _, err := r.ConnectLAN(ctx, password); err == nil {
+		t.Fatal("the receiver connected to an impostor")
+	}
+
+	select {
+		case payload := <-established:
+			if payload.Password != "" {
+				t.Errorf("the receiver presented %q to the impostor, want no password", payload.Password)
+			}
+
+		case <-ctx.Done():
+			t.Fatal("the receiver never connected to the announced impostor")
+	}
+}
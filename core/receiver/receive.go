@@ -2,25 +2,172 @@ package receiver
 
 import (
 	"io"
+	"time"
+	"context"
 	"encoding/json"
 
 	"github.com/gorilla/websocket"
 	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/constants"
 	"github.com/abdfnx/tran/models/protocol"
 )
 
-func (r *Receiver) Receive(wsConn *websocket.Conn, buffer io.Writer) error {
+// Receive requests the payload from the sender and writes it to buffer.
+// The connection is closed once ctx is done, every message has to arrive within the timeout of its phase.
+// The sender is notified with a TransferError if the transfer is aborted on this side.
+func (r *Receiver) Receive(ctx context.Context, wsConn *websocket.Conn, buffer io.Writer) error {
+	stop := r.abortOnDone(ctx, wsConn)
+	defer stop()
+
+	err := r.phaseError(ctx, r.receive(wsConn, buffer))
+	if err != nil && ctx.Err() == nil {
+		r.abort(wsConn, err)
+	}
+
+	return err
+}
+
+// Decline notifies the sender that the payload is not requested.
+func (r *Receiver) Decline(wsConn *websocket.Conn) {
+	r.abort(wsConn, protocol.ErrDeclined)
+}
+
+// Review has accept judge the payload by its manifest before it is requested, accept has to decide within the timeout of the review phase.
+// The sender is notified with a TransferError if the payload is declined, the review times out or ctx is done.
+func (r *Receiver) Review(ctx context.Context, wsConn *websocket.Conn, accept func(ctx context.Context) bool) error {
+	r.setPhase(wsConn, protocol.PhaseReview)
+
+	reviewCtx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout := r.timeouts.Of(protocol.PhaseReview); timeout > 0 {
+		reviewCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	defer cancel()
+
+	err := protocol.ErrDeclined
+	if accept(reviewCtx) {
+		err = nil
+	}
+
+	// a decision made after the review ended does not count
+	if reviewCtx.Err() != nil {
+		err = r.phaseError(ctx, reviewCtx.Err())
+	}
+
+	if err != nil {
+		r.abort(wsConn, err)
+	}
+
+	return err
+}
+
+func (r *Receiver) receive(wsConn *websocket.Conn, buffer io.Writer) error {
 	// request payload
-	tools.WriteEncryptedMessage(wsConn, protocol.TransferMessage{Type: protocol.ReceiverRequestPayload}, r.crypt)
+	streams := r.streamCount(buffer)
+
+	r.setPhase(wsConn, protocol.PhaseTransfer)
+	err := r.writeMessage(wsConn, protocol.TransferMessage{
+		Type:    protocol.ReceiverRequestPayload,
+		Payload: protocol.RequestPayload{Only: r.only, Streams: streams, Acks: r.window > 0},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// the sender prepares the payload of the selected files first
+	phase := protocol.PhaseTransfer
+	if len(r.only) > 0 {
+		phase = protocol.PhasePrepare
+	}
+
+	if streams > 0 {
+		err = r.receiveSegments(wsConn, buffer.(io.WriterAt), streams, phase)
+	} else {
+		err = r.receivePayload(wsConn, buffer, phase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// ACK received payload
+	r.setPhase(wsConn, protocol.PhaseClose)
+	err = r.writeMessage(wsConn, protocol.TransferMessage{Type: protocol.ReceiverPayloadAck})
+	if err != nil {
+		return err
+	}
+
+	transferMsg, err := tools.ReadEncryptedMessage(wsConn, r.crypt)
+	if err != nil {
+		return err
+	}
+	if transferMsg.Type != protocol.SenderClosing {
+		return protocol.NewWrongMessageTypeError([]protocol.TransferMessageType{protocol.SenderClosing}, transferMsg.Type)
+	}
+
+	// ACK SenderClosing with ReceiverClosing
+	return r.writeMessage(wsConn, protocol.TransferMessage{Type: protocol.ReceiverClosingAck})
+}
+
+// receivePayload receives the payload in one piece over wsConn, the first message has to arrive within the timeout of phase.
+// The messages are read ahead and decrypted in parallel, see tools.Pipeline, and written to buffer in order.
+func (r *Receiver) receivePayload(wsConn *websocket.Conn, buffer io.Writer, phase protocol.Phase) error {
+	pipeline := tools.NewPipeline(r.crypt.Decrypt)
+
+	var readErr error
+	readDone := make(chan struct{})
+
+	go func() {
+		defer close(readDone)
+		defer pipeline.CloseInput()
+
+		for {
+			r.setPhase(wsConn, phase)
+			phase = protocol.PhaseTransfer
+
+			if pipeline.Stopped() {
+				return
+			}
+
+			_, encBytes, err := wsConn.ReadMessage()
+			if err != nil {
+				readErr = err
+				return
+			}
+
+			chunk := pipeline.Push(encBytes)
+			if chunk == nil {
+				return
+			}
+
+			// only messages that fill a chunk are payload for sure, the others may end it and nothing must be read after the end
+			if len(encBytes) < constants.MAX_CHUNK_BYTES {
+				if decBytes, err := chunk.Result(); err != nil || endsPayload(decBytes) {
+					return
+				}
+			}
+		}
+	}()
+
+	defer func() {
+		// stop a read that is still waiting for a message
+		if !pipeline.Stopped() {
+			pipeline.Stop()
+			wsConn.SetReadDeadline(time.Now())
+		}
+
+		<-readDone
+	}()
 
 	var writtenBytes int64
 	for {
-		_, encBytes, err := wsConn.ReadMessage()
-		if err != nil {
-			return err
+		chunk, ok := pipeline.Next()
+		if !ok {
+			return readErr
 		}
 
-		decBytes, err := r.crypt.Decrypt(encBytes)
+		decBytes, err := chunk.Result()
 		if err != nil {
 			return err
 		}
@@ -28,30 +175,49 @@ func (r *Receiver) Receive(wsConn *websocket.Conn, buffer io.Writer) error {
 		transferMsg := protocol.TransferMessage{}
 		err = json.Unmarshal(decBytes, &transferMsg)
 		if err != nil {
-			buffer.Write(decBytes)
+			if _, err := buffer.Write(decBytes); err != nil {
+				return err
+			}
+
 			writtenBytes += int64(len(decBytes))
 			r.updateUI(float32(writtenBytes) / float32(r.payloadSize))
+
+			if err := r.acknowledge(wsConn, writtenBytes); err != nil {
+				return err
+			}
 		} else {
+			if transferMsg.Type == protocol.TransferError {
+				return protocol.NewPeerError(transferMsg.Payload)
+			}
+
+			if transferMsg.Type == protocol.SenderPayloadSelected {
+				selected := protocol.SelectedPayload{}
+				if err := tools.DecodePayload(transferMsg.Payload, &selected); err != nil {
+					return err
+				}
+
+				r.payloadSize = selected.PayloadSize
+				continue
+			}
+
 			if transferMsg.Type != protocol.SenderPayloadSent {
 				return protocol.NewWrongMessageTypeError([]protocol.TransferMessageType{protocol.SenderPayloadSent}, transferMsg.Type)
 			}
-			break
-		}
-	}
 
-	// ACK received payload
-	tools.WriteEncryptedMessage(wsConn, protocol.TransferMessage{Type: protocol.ReceiverPayloadAck}, r.crypt)
+			// the reader stopped at the end of the payload
+			pipeline.Stop()
 
-	transferMsg, err := tools.ReadEncryptedMessage(wsConn, r.crypt)
-	if err != nil {
-		return err
-	}
-	if transferMsg.Type != protocol.SenderClosing {
-		return protocol.NewWrongMessageTypeError([]protocol.TransferMessageType{protocol.SenderClosing}, transferMsg.Type)
+			return nil
+		}
 	}
+}
 
-	// ACK SenderClosing with ReceiverClosing
-	tools.WriteEncryptedMessage(wsConn, protocol.TransferMessage{Type: protocol.ReceiverClosingAck}, r.crypt)
+// endsPayload reports whether a message ends the payload, after which the sender waits for the receiver.
+func endsPayload(decBytes []byte) bool {
+	transferMsg := protocol.TransferMessage{}
+	if err := json.Unmarshal(decBytes, &transferMsg); err != nil {
+		return false
+	}
 
-	return err
+	return transferMsg.Type == protocol.SenderPayloadSent || transferMsg.Type == protocol.TransferError
 }
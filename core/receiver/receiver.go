@@ -1,23 +1,51 @@
 package receiver
 
 import (
+	"sync"
+	"errors"
+	"context"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
 	"github.com/abdfnx/tran/models"
 	"github.com/abdfnx/tran/core/crypt"
+	"github.com/abdfnx/tran/models/protocol"
 )
 
 type Receiver struct {
 	crypt             *crypt.Crypt
 	payloadSize       int64
+	manifest          *protocol.Manifest
+	only              []string
+	streams           int
+	offer             int
+	token             string
+	streamAddress     string
+	window            int64
+	acked             int64
+	compression       protocol.Compression
 	tranxAddress string
 	tranxPort    int
+	proxy        string
+	timeouts          models.Timeouts
+	direct            models.Direct
+	password          models.PasswordOptions
+	phase             protocol.Phase
 	ui                chan<- UIUpdate
 	usedRelay         bool
+	writeMu           sync.Mutex
 }
 
 func NewReceiver(programOptions models.TranOptions) *Receiver {
 	return &Receiver{
 		tranxAddress: programOptions.TranxAddress,
 		tranxPort:    programOptions.TranxPort,
+		proxy:        programOptions.Proxy,
+		timeouts:     programOptions.Timeouts,
+		direct:       programOptions.Direct,
+		password:     programOptions.Password,
+		streams:      programOptions.Streams,
 	}
 }
 
@@ -26,6 +54,12 @@ func WithUI(r *Receiver, ui chan<- UIUpdate) *Receiver {
 	return r
 }
 
+// WithSelection specifies the glob patterns of the files to request, every file is requested if there are none.
+func WithSelection(r *Receiver, only []string) *Receiver {
+	r.only = only
+	return r
+}
+
 func (r *Receiver) UsedRelay() bool {
 	return r.usedRelay
 }
@@ -34,6 +68,16 @@ func (r *Receiver) PayloadSize() int64 {
 	return r.payloadSize
 }
 
+// Manifest returns the manifest the sender described the payload with, nil if the sender sent none.
+func (r *Receiver) Manifest() *protocol.Manifest {
+	return r.manifest
+}
+
+// Compression returns the compression algorithm of the payload, the algorithm to decompress it with.
+func (r *Receiver) Compression() string {
+	return r.compression.Algorithm
+}
+
 func (r *Receiver) TranxAddress() string {
 	return r.tranxAddress
 }
@@ -42,6 +86,72 @@ func (r *Receiver) TranxPort() int {
 	return r.tranxPort
 }
 
+// setPhase moves the receiver to a phase of the transfer and applies the deadlines of the phase to the connection,
+// the deadlines are serialized with the writes of the other goroutines.
+func (r *Receiver) setPhase(wsConn *websocket.Conn, phase protocol.Phase) {
+	r.phase = phase
+
+	r.writeMu.Lock()
+	tools.SetDeadline(wsConn, r.timeouts.Of(phase))
+	r.writeMu.Unlock()
+}
+
+// phaseError translates an error that occurred in the current phase, see tools.PhaseError.
+func (r *Receiver) phaseError(ctx context.Context, err error) error {
+	return tools.PhaseError(ctx, r.phase, r.timeouts.Of(r.phase), err)
+}
+
+// writeMessage encrypts and writes a transfer message, writes are serialized with the abort notification.
+func (r *Receiver) writeMessage(wsConn *websocket.Conn, msg protocol.TransferMessage) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	return tools.WriteEncryptedMessage(wsConn, msg, r.crypt)
+}
+
+// abort notifies the sender that the transfer is aborted because of err,
+// unless no key is established yet or the sender aborted the transfer itself.
+func (r *Receiver) abort(wsConn *websocket.Conn, err error) {
+	var peerErr *protocol.PeerError
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	if r.crypt == nil || errors.As(err, &peerErr) {
+		return
+	}
+
+	tools.WriteTransferError(wsConn, r.crypt, tools.NewTransferErrorPayload(err))
+}
+
+// abortOnDone aborts the transfer and closes the connection once ctx is done, until the returned stop function is called.
+func (r *Receiver) abortOnDone(ctx context.Context, wsConn *websocket.Conn) (stop func()) {
+	return tools.OnDone(ctx, func() {
+		r.abort(wsConn, ctx.Err())
+		wsConn.Close()
+	})
+}
+
+// acknowledge tells the sender how many bytes of the payload were received, once a quarter of its window was received since the last time,
+// or a twentieth of the payload if that is less, which the sender shows the progress by. Senders of older versions offer no window
+// and take no acknowledgements.
+func (r *Receiver) acknowledge(wsConn *websocket.Conn, received int64) error {
+	interval := r.window / 4
+	if part := r.payloadSize / 20; part < interval {
+		interval = part
+	}
+
+	acked := atomic.LoadInt64(&r.acked)
+	if r.window <= 0 || received - acked < interval || !atomic.CompareAndSwapInt64(&r.acked, acked, received) {
+		return nil
+	}
+
+	return r.writeMessage(wsConn, protocol.TransferMessage{
+		Type:    protocol.ReceiverPayloadProgress,
+		Payload: protocol.ProgressPayload{Bytes: received},
+	})
+}
+
 func (r *Receiver) updateUI(progress float32) {
 	if r.ui == nil {
 		return
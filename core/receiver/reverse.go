@@ -0,0 +1,110 @@
+package receiver
+
+import (
+	"net"
+	"sync"
+	"context"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// acceptSender asks the sender to connect to the receiver, for when the receiver could not reach the sender server.
+// It returns the connection of the sender, or nil if the sender could not reach the receiver either.
+func (r *Receiver) acceptSender(ctx context.Context, tranxConn *websocket.Conn) (*websocket.Conn, error) {
+	listener, err := tools.ListenDirect(r.direct)
+	if err != nil {
+		return nil, err
+	}
+
+	senderCh := make(chan *websocket.Conn, 1)
+
+	// hijacked websocket connections outlive the server
+	server := &http.Server{Handler: r.handleSender(senderCh)}
+	go server.Serve(listener)
+	defer server.Close()
+
+	var localIP net.IP
+	if tcpAddr, ok := tranxConn.LocalAddr().(*net.TCPAddr); ok {
+		localIP = tcpAddr.IP
+	}
+
+	err = r.writeMessage(tranxConn, protocol.TransferMessage{
+		Type: protocol.ReceiverReverseCommunication,
+		Payload: protocol.ReceiverReversePayload{
+			Candidates: tools.ListenerCandidates(listener, localIP),
+			Port:       listener.Addr().(*net.TCPAddr).Port,
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the sender answers through tranx once it connected or gave up
+	r.setPhase(tranxConn, protocol.PhaseHandshake)
+	msg, err := tools.ReadEncryptedMessage(tranxConn, r.crypt)
+	if err != nil {
+		return nil, err
+	}
+
+	switch msg.Type {
+		case protocol.SenderReverseFailed:
+			return nil, nil
+
+		// the sender announced itself on the new connection before
+		case protocol.SenderReverseAck:
+			waitCtx, cancel := tools.WithTimeout(ctx, r.timeouts.Of(protocol.PhaseHandshake))
+			defer cancel()
+
+			select {
+				case wsConn := <-senderCh:
+					return wsConn, nil
+
+				case <-waitCtx.Done():
+					return nil, waitCtx.Err()
+			}
+
+		default:
+			return nil, protocol.NewWrongMessageTypeError(
+				[]protocol.TransferMessageType{protocol.SenderReverseAck, protocol.SenderReverseFailed}, msg.Type)
+	}
+}
+
+// handleSender creates a HandlerFunc that hands the first connection announcing the sender over on senderCh,
+// only the sender can encrypt the announcement, every other connection is closed.
+func (r *Receiver) handleSender(senderCh chan<- *websocket.Conn) http.HandlerFunc {
+	upgrader := websocket.Upgrader{}
+
+	var mu sync.Mutex
+	var connected bool
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		wsConn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+
+		tools.SetDeadline(wsConn, r.timeouts.Of(protocol.PhaseHandshake))
+		msg, err := tools.ReadEncryptedMessage(wsConn, r.crypt)
+		if err != nil || msg.Type != protocol.SenderReverseAck {
+			wsConn.Close()
+
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if connected {
+			wsConn.Close()
+
+			return
+		}
+
+		connected = true
+		senderCh <- wsConn
+	}
+}
@@ -0,0 +1,353 @@
+package receiver
+
+import (
+	"io"
+	"fmt"
+	"sync"
+	"time"
+	"errors"
+	"context"
+	"runtime"
+	"sync/atomic"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/constants"
+	"github.com/abdfnx/tran/core/crypt"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// segmentWriter reassembles the segments the streams receive in buffer, and acknowledges the bytes received with ack.
+type segmentWriter struct {
+	buffer   io.WriterAt
+	size     int64
+	received int64
+	ack      func(received int64) error
+}
+
+// segment is the range of the payload a stream receives at the moment.
+type segment struct {
+	offset    int64
+	remaining int64
+}
+
+// streamCount returns the number of streams to request the payload over, zero if it is to be received in one piece.
+// Only the server of the sender accepts further streams, the payload of a reversed or relayed transfer is received in one piece.
+func (r *Receiver) streamCount(buffer io.Writer) int {
+	if _, ok := buffer.(io.WriterAt); !ok || r.offer <= 0 || r.streamAddress == "" {
+		return 0
+	}
+
+	if r.streams > 0 && r.streams < r.offer {
+		return r.streams
+	}
+
+	return r.offer
+}
+
+// autoStreams returns the number of streams to receive the rest of the payload over, measured by the throughput of the stream zero.
+func (r *Receiver) autoStreams(offer int, received int64, elapsed time.Duration) int {
+	if elapsed <= 0 || float64(received) / elapsed.Seconds() < constants.AUTO_STREAMS_THROUGHPUT {
+		return 1
+	}
+
+	// further streams help as long as there are cores to decrypt on and segments to receive
+	streams := offer
+	if runtime.NumCPU() < streams {
+		streams = runtime.NumCPU()
+	}
+
+	if segments := int((r.payloadSize - received) / constants.STREAM_SEGMENT_BYTES) + 1; segments < streams {
+		streams = segments
+	}
+
+	return streams
+}
+
+// receiveSegments receives the payload in segments over wsConn, the stream zero, and the further streams it opens, up to offer of them.
+// If the user chose no number of streams, further streams are opened once the first segment shows that the link is fast enough.
+func (r *Receiver) receiveSegments(wsConn *websocket.Conn, buffer io.WriterAt, offer int, phase protocol.Phase) error {
+	stream, err := r.crypt.Stream(0)
+	if err != nil {
+		return err
+	}
+
+	// the acknowledgements of every stream are sent on the stream zero
+	writer := &segmentWriter{buffer: buffer, size: r.payloadSize, ack: func(received int64) error {
+		return r.acknowledge(wsConn, received)
+	}}
+	var current segment
+
+	var (
+		opened    bool
+		started   time.Time
+		extra     []*websocket.Conn
+		extraErr  error
+		failed    = make(chan struct{})
+		streamsWg sync.WaitGroup
+		mu        sync.Mutex
+	)
+
+	// a further stream that failed fails the transfer, the sender may tell why on the stream zero right after
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if extraErr == nil {
+			extraErr = err
+			close(failed)
+		}
+	}
+
+	streamErr := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return extraErr
+	}
+
+	defer func() {
+		mu.Lock()
+		for _, conn := range extra {
+			conn.Close()
+		}
+		mu.Unlock()
+
+		streamsWg.Wait()
+	}()
+
+	open := func(streams int) {
+		opened = true
+
+		for i := 1; i < streams; i++ {
+			streamsWg.Add(1)
+
+			go func(id int) {
+				defer streamsWg.Done()
+
+				conn, stream, err := r.openStream(id)
+				if err != nil {
+					// the other streams receive the segments this one would have
+					return
+				}
+
+				mu.Lock()
+				extra = append(extra, conn)
+				mu.Unlock()
+
+				if err := r.readSegments(conn, stream, writer); err != nil {
+					fail(err)
+				}
+			}(i)
+		}
+	}
+
+	for {
+		r.setPhase(wsConn, phase)
+		phase = protocol.PhaseTransfer
+
+		select {
+			case <-failed:
+				wsConn.SetReadDeadline(time.Now().Add(time.Second))
+
+			default:
+		}
+
+		_, encBytes, err := wsConn.ReadMessage()
+		if err != nil {
+			if extraErr := streamErr(); extraErr != nil {
+				return extraErr
+			}
+
+			return err
+		}
+
+		decBytes, err := stream.Decrypt(encBytes)
+		if err == nil {
+			if extraErr := streamErr(); extraErr != nil {
+				return extraErr
+			}
+
+			header, err := writer.receive(&current, decBytes)
+			if err != nil {
+				return err
+			}
+
+			switch {
+				case header && started.IsZero():
+					started = time.Now()
+
+					// the payload is selected by now, so the size the further streams check the segments against is final
+					if r.streams > 1 {
+						open(offer)
+					}
+
+				case !header:
+					r.updateUI(writer.progress())
+
+					if !opened && r.streams == 0 && current.remaining == 0 {
+						open(r.autoStreams(offer, atomic.LoadInt64(&writer.received), time.Since(started)))
+					}
+			}
+
+			continue
+		}
+
+		// the control messages are encrypted like the ones before the payload
+		decBytes, err = r.crypt.Decrypt(encBytes)
+		if err != nil {
+			return err
+		}
+
+		transferMsg := protocol.TransferMessage{}
+		if err = json.Unmarshal(decBytes, &transferMsg); err != nil {
+			return err
+		}
+
+		if transferMsg.Type == protocol.TransferError {
+			return protocol.NewPeerError(transferMsg.Payload)
+		}
+
+		if extraErr := streamErr(); extraErr != nil {
+			return extraErr
+		}
+
+		switch transferMsg.Type {
+			case protocol.SenderPayloadSelected:
+				selected := protocol.SelectedPayload{}
+				if err := tools.DecodePayload(transferMsg.Payload, &selected); err != nil {
+					return err
+				}
+
+				r.payloadSize = selected.PayloadSize
+				writer.size = selected.PayloadSize
+
+			case protocol.SenderPayloadSent:
+				// the sender announces the payload once every stream is done
+				streamsWg.Wait()
+
+				if extraErr := streamErr(); extraErr != nil {
+					return extraErr
+				}
+
+				if received := atomic.LoadInt64(&writer.received); current.remaining != 0 || received != r.payloadSize {
+					return fmt.Errorf("received %d bytes of a payload of %d bytes", received, r.payloadSize)
+				}
+
+				return nil
+
+			default:
+				return protocol.NewWrongMessageTypeError([]protocol.TransferMessageType{protocol.SenderPayloadSent}, transferMsg.Type)
+		}
+	}
+}
+
+// openStream opens the further stream id to the sender server, the receiver proves with the key of the transfer that it may.
+func (r *Receiver) openStream(id int) (*websocket.Conn, *crypt.Stream, error) {
+	stream, err := r.crypt.Stream(uint32(id))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := tools.WithTimeout(context.Background(), r.timeouts.Of(protocol.PhaseConnect))
+	defer cancel()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, fmt.Sprintf("ws://%s/stream", r.streamAddress), tools.TokenHeader(r.token))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tools.SetDeadline(conn, r.timeouts.Of(protocol.PhaseHandshake))
+	err = tools.WriteEncryptedMessage(conn, protocol.TransferMessage{
+		Type:    protocol.ReceiverStream,
+		Payload: protocol.StreamPayload{Stream: id},
+	}, r.crypt)
+
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, stream, nil
+}
+
+// readSegments receives segments over a further stream until the sender is done with it.
+func (r *Receiver) readSegments(conn *websocket.Conn, stream *crypt.Stream, writer *segmentWriter) error {
+	var current segment
+
+	for {
+		tools.SetDeadline(conn, r.timeouts.Of(protocol.PhaseTransfer))
+		_, encBytes, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		decBytes, err := stream.Decrypt(encBytes)
+		if err != nil {
+			return err
+		}
+
+		// the stream is done once the sender sent all segments it took
+		if current.remaining == 0 {
+			transferMsg := protocol.TransferMessage{}
+			if json.Unmarshal(decBytes, &transferMsg) == nil && transferMsg.Type == protocol.SenderStreamDone {
+				return nil
+			}
+		}
+
+		header, err := writer.receive(&current, decBytes)
+		if err != nil {
+			return err
+		}
+
+		if !header {
+			r.updateUI(writer.progress())
+		}
+	}
+}
+
+// receive handles a message of a stream, the header of a segment if the stream received its current one completely,
+// and otherwise the next bytes of it. It reports whether the message was a header.
+func (w *segmentWriter) receive(current *segment, data []byte) (bool, error) {
+	if current.remaining == 0 {
+		transferMsg := protocol.TransferMessage{}
+		if err := json.Unmarshal(data, &transferMsg); err != nil {
+			return false, err
+		}
+
+		if transferMsg.Type != protocol.SenderSegment {
+			return false, protocol.NewWrongMessageTypeError([]protocol.TransferMessageType{protocol.SenderSegment}, transferMsg.Type)
+		}
+
+		segmentPayload := protocol.SegmentPayload{}
+		if err := tools.DecodePayload(transferMsg.Payload, &segmentPayload); err != nil {
+			return false, err
+		}
+
+		if segmentPayload.Offset < 0 || segmentPayload.Size <= 0 || segmentPayload.Offset + segmentPayload.Size > w.size {
+			return false, fmt.Errorf("segment of %d bytes at %d exceeds the payload of %d bytes", segmentPayload.Size, segmentPayload.Offset, w.size)
+		}
+
+		*current = segment{offset: segmentPayload.Offset, remaining: segmentPayload.Size}
+
+		return true, nil
+	}
+
+	if int64(len(data)) > current.remaining {
+		return false, errors.New("the sender sent more bytes than the segment has")
+	}
+
+	if _, err := w.buffer.WriteAt(data, current.offset); err != nil {
+		return false, err
+	}
+
+	current.offset += int64(len(data))
+	current.remaining -= int64(len(data))
+
+	return false, w.ack(atomic.AddInt64(&w.received, int64(len(data))))
+}
+
+func (w *segmentWriter) progress() float32 {
+	return float32(atomic.LoadInt64(&w.received)) / float32(w.size)
+}
@@ -0,0 +1,166 @@
+package receiver
+
+import (
+	"bytes"
+	"testing"
+	"math/rand"
+	"encoding/json"
+
+	"github.com/abdfnx/tran/core/crypt"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// memoryBuffer is the payload the segments are written to.
+type memoryBuffer []byte
+
+func (b memoryBuffer) WriteAt(data []byte, offset int64) (int, error) {
+	return copy(b[offset:], data), nil
+}
+
+// streamCiphers returns the ciphers of the streams of a transfer, for the sender and for the receiver.
+func streamCiphers(t *testing.T, streams int) ([]*crypt.Stream, []*crypt.Stream) {
+	senderCrypt, err := crypt.New([]byte("the session key of the transfer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receiverCrypt, err := crypt.New([]byte("the session key of the transfer"), senderCrypt.Salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sending, receiving []*crypt.Stream
+
+	for id := 0; id < streams; id++ {
+		senderStream, err := senderCrypt.Stream(uint32(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		receiverStream, err := receiverCrypt.Stream(uint32(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sending, receiving = append(sending, senderStream), append(receiving, receiverStream)
+	}
+
+	return sending, receiving
+}
+
+// sendSegment encrypts the header and the chunks of the segment of payload at offset like the sender does.
+func sendSegment(t *testing.T, stream *crypt.Stream, payload []byte, offset, size, chunkSize int) [][]byte {
+	header, err := json.Marshal(protocol.TransferMessage{
+		Type:    protocol.SenderSegment,
+		Payload: protocol.SegmentPayload{Offset: int64(offset), Size: int64(size)},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := [][]byte{header}
+	for sent := 0; sent < size; sent += chunkSize {
+		end := sent + chunkSize
+		if end > size {
+			end = size
+		}
+
+		messages = append(messages, payload[offset+sent:offset+end])
+	}
+
+	for i, message := range messages {
+		enc, err := stream.Encrypt(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		messages[i] = enc
+	}
+
+	return messages
+}
+
+func TestSegmentsRoundTripOverStreams(t *testing.T) {
+	const (
+		streams     = 3
+		segmentSize = 1000
+		chunkSize   = 300
+	)
+
+	random := rand.New(rand.NewSource(1))
+	payload := make([]byte, 10*segmentSize+123)
+	random.Read(payload)
+
+	sending, receiving := streamCiphers(t, streams)
+
+	// the segments are taken by the streams in a random order, every stream sends its own in the order it took them
+	queued := make([][][]byte, streams)
+	for i, segment := range random.Perm(len(payload)/segmentSize + 1) {
+		offset, size := segment*segmentSize, segmentSize
+		if offset+size > len(payload) {
+			size = len(payload) - offset
+		}
+
+		id := i % streams
+		queued[id] = append(queued[id], sendSegment(t, sending[id], payload, offset, size, chunkSize)...)
+	}
+
+	var acknowledged int64
+	buffer := make(memoryBuffer, len(payload))
+	writer := &segmentWriter{buffer: buffer, size: int64(len(payload)), ack: func(received int64) error {
+		acknowledged = received
+		return nil
+	}}
+
+	var remaining int
+	for _, messages := range queued {
+		remaining += len(messages)
+	}
+
+	// the messages of the streams arrive interleaved
+	current := make([]segment, streams)
+	for ; remaining > 0; remaining-- {
+		id := random.Intn(streams)
+		for len(queued[id]) == 0 {
+			id = (id + 1) % streams
+		}
+
+		data, err := receiving[id].Decrypt(queued[id][0])
+		if err != nil {
+			t.Fatalf("stream %d: %v", id, err)
+		}
+
+		queued[id] = queued[id][1:]
+
+		if _, err := writer.receive(&current[id], data); err != nil {
+			t.Fatalf("stream %d: %v", id, err)
+		}
+	}
+
+	if acknowledged != int64(len(payload)) {
+		t.Errorf("%d bytes were acknowledged, want %d", acknowledged, len(payload))
+	}
+
+	if !bytes.Equal(buffer, payload) {
+		t.Error("the segments were not reassembled into the payload")
+	}
+}
+
+func TestSegmentsOutsideThePayloadAreRejected(t *testing.T) {
+	sending, receiving := streamCiphers(t, 1)
+	writer := &segmentWriter{buffer: make(memoryBuffer, 1000), size: 1000, ack: func(int64) error { return nil }}
+
+	// a segment that ends past the payload
+	messages := sendSegment(t, sending[0], make([]byte, 1500), 500, 1000, 1000)
+
+	data, err := receiving[0].Decrypt(messages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var current segment
+	if _, err := writer.receive(&current, data); err == nil {
+		t.Error("a segment past the end of the payload was accepted")
+	}
+}
@@ -14,115 +14,249 @@ import (
 	"github.com/abdfnx/tran/models/protocol"
 )
 
-func (r *Receiver) ConnectToTranx(tranxAddress string, tranxPort int, password models.Password) (*websocket.Conn, error) {
+// probeTimeout bounds the attempts to connect directly to the other side.
+const probeTimeout = 3 * time.Second
+
+// ConnectToTranx establishes the connection with the sender through the tranx server,
+// and returns either a direct connection to the sender or the relayed tranx connection.
+func (r *Receiver) ConnectToTranx(ctx context.Context, tranxAddress string, tranxPort int, password models.Password) (*websocket.Conn, error) {
+	return r.connectTranx(ctx, tranxAddress, tranxPort, "establish-receiver", func(tranxConn *websocket.Conn) error {
+		return r.establishSecureConnection(tranxConn, password, tools.HashPassword(password), false)
+	})
+}
+
+// RequestFromTranx requests a payload on the tranx server and waits for a sender to send it, see ConnectToTranx.
+// The password the sender needs is communicated on passwordCh, TranxAddress and TranxPort report the tranx server from then on.
+func (r *Receiver) RequestFromTranx(ctx context.Context, tranxAddress string, tranxPort int, passwordCh chan<- models.Password) (*websocket.Conn, error) {
+	return r.connectTranx(ctx, tranxAddress, tranxPort, "establish-requester", func(tranxConn *websocket.Conn) error {
+		r.setPhase(tranxConn, protocol.PhaseConnect)
+		tranxMsg, err := tools.ReadTranxMessage(tranxConn, protocol.TranxToSenderBind)
+		if err != nil {
+			return err
+		}
+
+		bindPayload := protocol.TranxToSenderBindPayload{}
+		err = tools.DecodePayload(tranxMsg.Payload, &bindPayload)
+		if err != nil {
+			return err
+		}
+
+		password, err := tools.GeneratePassword(bindPayload.ID, r.password)
+		if err != nil {
+			return err
+		}
+
+		passwordCh <- password
+
+		return r.establishSecureConnection(tranxConn, password, tools.HashPassword(password), true)
+	})
+}
+
+// connectTranx connects to the tranx server at path, establishes the secure connection with the sender
+// by calling establish and negotiates the connection to receive over.
+func (r *Receiver) connectTranx(ctx context.Context, tranxAddress string, tranxPort int, path string,
+	establish func(tranxConn *websocket.Conn) error) (*websocket.Conn, error) {
 	// establish websocket connection to tranx server
-	tranxConn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s:%d/establish-receiver", tranxAddress, tranxPort), nil)
+	r.tranxAddress, r.tranxPort = tranxAddress, tranxPort
+	r.phase = protocol.PhaseConnect
+	dialCtx, cancel := tools.WithTimeout(ctx, r.timeouts.Of(protocol.PhaseConnect))
+	tranxConn, _, err := tools.TranxDialer(r.proxy).DialContext(dialCtx, fmt.Sprintf("ws://%s:%d/%s", tranxAddress, tranxPort, path), nil)
+	cancel()
 
 	if err != nil {
-		return nil, err
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, &protocol.UnreachableError{Address: fmt.Sprintf("%s:%d", tranxAddress, tranxPort), Err: r.phaseError(ctx, err)}
 	}
 
-	err = r.establishSecureConnection(tranxConn, password)
+	stop := r.abortOnDone(ctx, tranxConn)
+	defer stop()
+
+	wsConn, err := r.negotiate(ctx, tranxConn, establish)
 	if err != nil {
+		err = r.phaseError(ctx, err)
+		if ctx.Err() == nil {
+			r.abort(tranxConn, err)
+		}
+
+		tranxConn.Close()
+
 		return nil, err
 	}
 
-	senderIP, senderPort, err := r.doTransferHandshake(tranxConn)
+	return wsConn, nil
+}
+
+// negotiate does the key exchange and handshake over the tranx connection and chooses between direct and relay communication.
+func (r *Receiver) negotiate(ctx context.Context, tranxConn *websocket.Conn, establish func(tranxConn *websocket.Conn) error) (*websocket.Conn, error) {
+	err := establish(tranxConn)
+	if err != nil {
+		return nil, err
+	}
 
+	handshake, err := r.doTransferHandshake(tranxConn)
 	if err != nil {
 		return nil, err
 	}
 
-	directConn, err := r.probeSender(senderIP, senderPort)
+	// the sender relays the transfer if it does not serve it directly
+	if !r.direct.Disabled && handshake.Port != 0 {
+		directConn, err := r.connectDirect(ctx, tranxConn, handshake)
+		if err != nil || directConn != nil {
+			return directConn, err
+		}
+	}
+
+	r.usedRelay = true
+	if err = r.keepConnection(tranxConn); err != nil {
+		return nil, err
+	}
+
+	return tranxConn, nil
+}
+
+// connectDirect connects to the server of the sender, or lets the sender connect to the receiver if that fails.
+// It returns nil if neither can reach the other.
+func (r *Receiver) connectDirect(ctx context.Context, tranxConn *websocket.Conn, handshake protocol.SenderHandshakePayload) (*websocket.Conn, error) {
+	directConn, err := r.probeSender(ctx, handshake)
+	r.setPhase(tranxConn, protocol.PhaseHandshake)
 
 	if err == nil {
+		// further streams are opened to the same address
+		r.streamAddress = directConn.RemoteAddr().String()
+
 		// notify sender through tranx that we will be using direct communication
-		tools.WriteEncryptedMessage(tranxConn, protocol.TransferMessage{Type: protocol.ReceiverDirectCommunication}, r.crypt)
-		// tell tranx to close the connection
-		tranxConn.WriteJSON(protocol.TranxMessage{Type: protocol.ReceiverToTranxClose})
+		r.writeMessage(tranxConn, protocol.TransferMessage{Type: protocol.ReceiverDirectCommunication})
+		r.closeTranx(tranxConn)
 
 		return directConn, nil
 	}
 
-	r.usedRelay = true
-	tools.WriteEncryptedMessage(tranxConn, protocol.TransferMessage{Type: protocol.ReceiverRelayCommunication}, r.crypt)
-
-	transferMsg, err := tools.ReadEncryptedMessage(tranxConn, r.crypt)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 
-	if err != nil {
-		return nil, err
+	// the sender may be able to reach us instead
+	if !handshake.Reverse {
+		return nil, nil
 	}
 
-	if transferMsg.Type != protocol.SenderRelayAck {
+	reverseConn, err := r.acceptSender(ctx, tranxConn)
+	if err != nil || reverseConn == nil {
 		return nil, err
 	}
 
-	return tranxConn, nil
+	r.closeTranx(tranxConn)
+
+	return reverseConn, nil
 }
 
-func (r *Receiver) probeSender(senderIP net.IP, senderPort int) (*websocket.Conn, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// closeTranx tells tranx to close the connection, which is not used for the transfer.
+func (r *Receiver) closeTranx(tranxConn *websocket.Conn) {
+	r.writeMu.Lock()
+	tranxConn.WriteJSON(protocol.TranxMessage{Type: protocol.ReceiverToTranxClose})
+	r.writeMu.Unlock()
+	tranxConn.Close()
+}
+
+// keepConnection tells the sender that the payload is transferred over the connection used for the handshake.
+func (r *Receiver) keepConnection(wsConn *websocket.Conn) error {
+	err := r.writeMessage(wsConn, protocol.TransferMessage{Type: protocol.ReceiverRelayCommunication})
+	if err != nil {
+		return err
+	}
 
-	d := 250 * time.Millisecond
+	transferMsg, err := tools.ReadEncryptedMessage(wsConn, r.crypt)
+	if err != nil {
+		return err
+	}
 
-	for {
-		select {
-			case <-ctx.Done():
-				return nil, fmt.Errorf("could not establish a connection to the sender server")
+	if transferMsg.Type != protocol.SenderRelayAck {
+		return protocol.NewWrongMessageTypeError([]protocol.TransferMessageType{protocol.SenderRelayAck}, transferMsg.Type)
+	}
 
-			default:
-				dialer := websocket.Dialer{HandshakeTimeout: d}
-				wsConn, _, err := dialer.Dial(fmt.Sprintf("ws://%s:%d/tran", senderIP.String(), senderPort), nil)
+	return nil
+}
 
-				if err != nil {
-					time.Sleep(d)
-					d = d * 2
-					continue
-				}
+// probeSender dials every candidate address of the sender server presenting the token of the handshake, see tools.DialCandidates.
+func (r *Receiver) probeSender(ctx context.Context, handshake protocol.SenderHandshakePayload) (*websocket.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
 
-				return wsConn, nil
-		}
+	wsConn, err := tools.DialCandidates(ctx, handshake.Candidates, handshake.Port, "/tran", tools.TokenHeader(handshake.Token))
+	if err != nil {
+		return nil, fmt.Errorf("could not establish a connection to the sender server: %w", err)
 	}
+
+	return wsConn, nil
 }
 
-func (r *Receiver) doTransferHandshake(wsConn *websocket.Conn) (net.IP, int, error) {
-	tcpAddr, _ := wsConn.LocalAddr().(*net.TCPAddr)
+// doTransferHandshake exchanges the addresses with the sender and returns the handshake of the sender,
+// its Candidates always list the addresses of the sender server.
+func (r *Receiver) doTransferHandshake(wsConn *websocket.Conn) (protocol.SenderHandshakePayload, error) {
+	// the address of connections that are not TCP, like ones of a custom dialer, is unknown
+	var localIP net.IP
+	if tcpAddr, ok := wsConn.LocalAddr().(*net.TCPAddr); ok {
+		localIP = tcpAddr.IP
+	}
 
 	msg := protocol.TransferMessage{
 		Type: protocol.ReceiverHandshake,
 		Payload: protocol.ReceiverHandshakePayload{
-			IP: tcpAddr.IP,
+			IP:           localIP,
+			Candidates:   tools.CandidateIPs(localIP),
+			Compressions: protocol.Compressions,
 		},
 	}
 
-	err := tools.WriteEncryptedMessage(wsConn, msg, r.crypt)
+	r.setPhase(wsConn, protocol.PhaseHandshake)
+	err := r.writeMessage(wsConn, msg)
 	if err != nil {
-		return nil, 0, err
+		return protocol.SenderHandshakePayload{}, err
 	}
 
+	// the sender answers once its payload is compressed
+	r.setPhase(wsConn, protocol.PhasePrepare)
 	msg, err = tools.ReadEncryptedMessage(wsConn, r.crypt)
 	if err != nil {
-		return nil, 0, err
+		return protocol.SenderHandshakePayload{}, err
 	}
 
 	if msg.Type != protocol.SenderHandshake {
-		return nil, 0, protocol.NewWrongMessageTypeError([]protocol.TransferMessageType{protocol.SenderHandshake}, msg.Type)
+		return protocol.SenderHandshakePayload{}, protocol.NewWrongMessageTypeError([]protocol.TransferMessageType{protocol.SenderHandshake}, msg.Type)
 	}
 
 	handshakePayload := protocol.SenderHandshakePayload{}
 	err = tools.DecodePayload(msg.Payload, &handshakePayload)
 
 	if err != nil {
-		return nil, 0, err
+		return protocol.SenderHandshakePayload{}, err
 	}
 
 	r.payloadSize = handshakePayload.PayloadSize
+	r.manifest = handshakePayload.Manifest
+	r.offer, r.token = handshakePayload.Streams, handshakePayload.Token
+	r.window = handshakePayload.Window
+
+	// senders of older versions compress the payload with gzip
+	r.compression = protocol.Compression{Algorithm: protocol.CompressionGzip}
+	if handshakePayload.Compression != nil {
+		r.compression = *handshakePayload.Compression
+	}
+
+	// senders of older versions only announce the address of their tranx connection
+	if len(handshakePayload.Candidates) == 0 {
+		handshakePayload.Candidates = []net.IP{handshakePayload.IP}
+	}
 
-	return handshakePayload.IP, handshakePayload.Port, nil
+	return handshakePayload, nil
 }
 
-func (r *Receiver) establishSecureConnection(wsConn *websocket.Conn, password models.Password) error {
+// establishSecureConnection does the key exchange with the sender, presenting the hashed password to tranx. If rendezvous is set
+// the receiver requested the payload and waits for the sender to join first.
+func (r *Receiver) establishSecureConnection(wsConn *websocket.Conn, password models.Password, hashed string, rendezvous bool) error {
 	// init curve in background
 	pakeCh := make(chan *pake.Pake)
 	pakeErr := make(chan error)
@@ -134,13 +268,27 @@ func (r *Receiver) establishSecureConnection(wsConn *websocket.Conn, password mo
 		pakeCh <- p
 	}()
 
-	wsConn.WriteJSON(protocol.TranxMessage{
+	r.setPhase(wsConn, protocol.PhaseKeyExchange)
+	err := wsConn.WriteJSON(protocol.TranxMessage{
 		Type: protocol.ReceiverToTranxEstablish,
 		Payload: protocol.PasswordPayload{
-			Password: tools.HashPassword(password),
+			Password: hashed,
 		},
 	})
 
+	if err != nil {
+		return err
+	}
+
+	if rendezvous {
+		r.setPhase(wsConn, protocol.PhaseRendezvous)
+		if _, err = tools.ReadTranxMessage(wsConn, protocol.TranxToReceiverReady); err != nil {
+			return err
+		}
+
+		r.setPhase(wsConn, protocol.PhaseKeyExchange)
+	}
+
 	msg, err := tools.ReadTranxMessage(wsConn, protocol.TranxToReceiverPAKE)
 	if err != nil {
 		return err
@@ -165,13 +313,17 @@ func (r *Receiver) establishSecureConnection(wsConn *websocket.Conn, password mo
 		return err
 	}
 
-	wsConn.WriteJSON(protocol.TranxMessage{
+	err = wsConn.WriteJSON(protocol.TranxMessage{
 		Type: protocol.ReceiverToTranxPAKE,
 		Payload: protocol.PakePayload{
 			Bytes: p.Bytes(),
 		},
 	})
 
+	if err != nil {
+		return err
+	}
+
 	msg, err = tools.ReadTranxMessage(wsConn, protocol.TranxToReceiverSalt)
 
 	if err != nil {
@@ -190,10 +342,15 @@ func (r *Receiver) establishSecureConnection(wsConn *websocket.Conn, password mo
 		return err
 	}
 
-	r.crypt, err = crypt.New(sessionKey, saltPayload.Salt)
+	c, err := crypt.New(sessionKey, saltPayload.Salt)
 	if err != nil {
 		return err
 	}
 
+	// from here on the sender can be notified when the transfer is aborted
+	r.writeMu.Lock()
+	r.crypt = c
+	r.writeMu.Unlock()
+
 	return nil
 }
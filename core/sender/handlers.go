@@ -2,32 +2,89 @@ package sender
 
 import (
 	"fmt"
-	"log"
 	"net"
-	"syscall"
+	"errors"
 	"net/http"
+
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models/protocol"
 )
 
 // handleTransfer creates a HandlerFunc to handle serving the transfer of files over a websocket connection
 func (s *Sender) handleTransfer() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if s.receiverIP.Equal(net.ParseIP(r.RemoteAddr)) {
+		// only the receiver learned the token, and it is used up once a transfer has started
+		if !tools.HasToken(r, s.token) || s.isClaimed() {
 			w.WriteHeader(http.StatusForbidden)
 			fmt.Fprintf(w, "No Tran for You!")
-			log.Printf("Unauthorized Tran attempt from alien species with IP: %s\n", r.RemoteAddr)
 
 			return
 		}
 
 		wsConn, err := s.senderServer.upgrader.Upgrade(w, r, nil)
 		if err != nil {
-			log.Printf("Unable to initialize Tran due to technical error: %s\n", err)
-			s.closeServer <- syscall.SIGTERM
+			s.finishTransfer(fmt.Errorf("unable to initialize Tran due to technical error: %w", err))
+
+			return
+		}
+
+		// the receiver dials all candidate addresses and keeps the connection it sends its request over,
+		// the others are closed without a message and must not end the transfer,
+		// the one the receiver kept while reviewing the manifest for too long does
+		s.setPhase(wsConn, protocol.PhaseReview)
+		first := s.readNext(wsConn)
+		received := <-first
+
+		var netErr net.Error
+		var peerErr *protocol.PeerError
+		timedOut := errors.As(received.err, &netErr) && netErr.Timeout()
+		if received.err != nil && !errors.As(received.err, &peerErr) && !timedOut {
+			wsConn.Close()
 
 			return
 		}
 
-		// Start transfer sequence.
-		s.Transfer(wsConn)
+		if !s.claimTransfer() {
+			wsConn.Close()
+
+			return
+		}
+
+		replay := make(chan readResult, 1)
+		replay <- received
+
+		// Start transfer sequence, the result is reported once the server is closed.
+		s.finishTransfer(s.transferFrom(r.Context(), wsConn, replay))
 	}
 }
+
+// isClaimed reports whether a direct transfer has been started.
+func (s *Sender) isClaimed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.claimed
+}
+
+// claimTransfer reports whether no direct transfer has been started yet and marks one as started.
+func (s *Sender) claimTransfer() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.claimed {
+		return false
+	}
+
+	s.claimed = true
+
+	return true
+}
+
+// finishTransfer records the result of a direct transfer and closes the server.
+func (s *Sender) finishTransfer(err error) {
+	s.mu.Lock()
+	s.transferErr = err
+	s.mu.Unlock()
+
+	s.CloseServer()
+}
@@ -0,0 +1,163 @@
+package sender
+
+import (
+	"net"
+	"context"
+	"net/http"
+	"math/rand"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models"
+	"github.com/abdfnx/tran/core/discovery"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// maxLANPasswordID bounds the numeric password prefix, which tranx allocates otherwise.
+const maxLANPasswordID = 100
+
+// ConnectLAN announces the sender on the local network and establishes the connection with the receiver that finds it there.
+// The key exchange and handshake are the same as through tranx, the payload is transferred over the returned connection.
+// Parameters:
+// ctx              -   context that aborts the communication when done.
+// passwordCh       -   channel to communicate the password to the caller.
+// payloadReady    	-   channel over which the caller can communicate when the payload is ready.
+func (s *Sender) ConnectLAN(ctx context.Context, passwordCh chan<- models.Password, payloadReady <-chan bool) (*websocket.Conn, error) {
+	s.enterPhase(protocol.PhaseConnect)
+	listener, err := tools.ListenDirect(s.direct)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := tools.GeneratePassword(rand.Intn(maxLANPasswordID) + 1, s.password)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	receiverCh := make(chan *websocket.Conn)
+	done := make(chan struct{})
+	defer close(done)
+
+	// hijacked websocket connections outlive the server
+	server := &http.Server{Handler: s.handleLANReceiver(receiverCh, done)}
+	go server.Serve(listener)
+	defer server.Close()
+
+	passwordCh <- password
+
+	announceCtx, stopAnnouncing := context.WithCancel(ctx)
+	defer stopAnnouncing()
+
+	announceErr := make(chan error, 1)
+	go func() {
+		announceErr <- discovery.Announce(announceCtx, discovery.ID(password), listener.Addr().(*net.TCPAddr).Port)
+	}()
+
+	// wait for the receiver to find the sender, anyone on the network may connect,
+	// only a receiver that knows the password completes the key exchange
+	s.enterPhase(protocol.PhaseRendezvous)
+	rendezvousCtx, cancel := tools.WithTimeout(ctx, s.timeouts.Of(protocol.PhaseRendezvous))
+	defer cancel()
+
+	var wsConn *websocket.Conn
+	var receiverHandshake protocol.ReceiverHandshakePayload
+
+	for wsConn == nil {
+		select {
+			case conn := <-receiverCh:
+				receiverHandshake, err = s.exchangeLANKey(rendezvousCtx, conn, password)
+				if err != nil {
+					// the client did not know the password, keep waiting for the receiver
+					conn.Close()
+					s.enterPhase(protocol.PhaseRendezvous)
+
+					continue
+				}
+
+				wsConn = conn
+				stopAnnouncing()
+
+			case err := <-announceErr:
+				return nil, s.phaseError(ctx, err)
+
+			case <-rendezvousCtx.Done():
+				return nil, s.phaseError(ctx, rendezvousCtx.Err())
+		}
+	}
+
+	stop := s.abortOnDone(ctx, wsConn)
+	defer stop()
+
+	err = s.negotiateLAN(ctx, wsConn, receiverHandshake, payloadReady)
+	if err != nil {
+		err = s.phaseError(ctx, err)
+		if ctx.Err() == nil {
+			s.abort(wsConn, err)
+		}
+
+		wsConn.Close()
+
+		return nil, err
+	}
+
+	return wsConn, nil
+}
+
+// exchangeLANKey does the key exchange with a client that connected directly and reads the handshake it encrypted,
+// which only a receiver that knows the password can. The client learns nothing it could guess the password from offline.
+func (s *Sender) exchangeLANKey(ctx context.Context, wsConn *websocket.Conn, password models.Password) (protocol.ReceiverHandshakePayload, error) {
+	stop := tools.OnDone(ctx, func() {
+		wsConn.Close()
+	})
+
+	defer stop()
+
+	if err := s.establishSecureConnection(wsConn, password, directKeyExchange); err != nil {
+		return protocol.ReceiverHandshakePayload{}, err
+	}
+
+	return s.readReceiverHandshake(wsConn)
+}
+
+// negotiateLAN answers the handshake of a receiver that connected directly.
+func (s *Sender) negotiateLAN(ctx context.Context, wsConn *websocket.Conn, receiverHandshake protocol.ReceiverHandshakePayload, payloadReady <-chan bool) error {
+	err := s.answerHandshake(ctx, wsConn, receiverHandshake, payloadReady, nil)
+	if err != nil {
+		return err
+	}
+
+	// without a server the receiver can only keep using the connection
+	_, err = s.chooseTransport(ctx, wsConn, false)
+
+	return err
+}
+
+// handleLANReceiver creates a HandlerFunc that hands the clients over on receiverCh one after the other, until done is closed.
+// The clients are answered the way tranx does, a client that does not know the password fails the key exchange.
+func (s *Sender) handleLANReceiver(receiverCh chan<- *websocket.Conn, done <-chan struct{}) http.HandlerFunc {
+	upgrader := websocket.Upgrader{}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		wsConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		// receivers present no password, anyone on the network could announce a sender to learn it
+		tools.SetDeadline(wsConn, s.timeouts.Of(protocol.PhaseKeyExchange))
+		if _, err := tools.ReadTranxMessage(wsConn, protocol.ReceiverToTranxEstablish); err != nil {
+			wsConn.Close()
+
+			return
+		}
+
+		select {
+			case receiverCh <- wsConn:
+
+			case <-done:
+				tools.WriteTranxError(wsConn, protocol.TranxErrorCodeInUse, "another receiver is already using this password")
+				wsConn.Close()
+		}
+	}
+}
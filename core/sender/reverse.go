@@ -0,0 +1,53 @@
+package sender
+
+import (
+	"time"
+	"context"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// reverseTimeout bounds the attempts to connect to the receiver.
+const reverseTimeout = 3 * time.Second
+
+// connectReverse connects to the server the receiver announced in msg and returns the connection.
+// If the receiver can not be reached either, the receiver is told so and the transport is chosen again over tranxConn.
+func (s *Sender) connectReverse(ctx context.Context, tranxConn *websocket.Conn, msg protocol.TransferMessage) (*websocket.Conn, error) {
+	reversePayload := protocol.ReceiverReversePayload{}
+	err := tools.DecodePayload(msg.Payload, &reversePayload)
+	if err != nil {
+		return nil, err
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, reverseTimeout)
+	wsConn, err := tools.DialCandidates(dialCtx, reversePayload.Candidates, reversePayload.Port, "/tran", nil)
+	cancel()
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if err = s.writeMessage(tranxConn, protocol.TransferMessage{Type: protocol.SenderReverseFailed}); err != nil {
+			return nil, err
+		}
+
+		return s.chooseTransport(ctx, tranxConn, false)
+	}
+
+	// announce the sender on the new connection first, the receiver waits for it after reading the ack through tranx
+	err = s.writeMessage(wsConn, protocol.TransferMessage{Type: protocol.SenderReverseAck})
+	if err == nil {
+		err = s.writeMessage(tranxConn, protocol.TransferMessage{Type: protocol.SenderReverseAck})
+	}
+
+	if err != nil {
+		wsConn.Close()
+
+		return nil, err
+	}
+
+	return wsConn, nil
+}
@@ -3,41 +3,81 @@ package sender
 import (
 	"os"
 	"io"
-	"fmt"
-	"net"
+	"sync"
+	"errors"
 	"time"
-	"syscall"
+	"context"
 	"net/http"
-	"os/signal"
 
 	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
 	"github.com/abdfnx/tran/models"
 	"github.com/abdfnx/tran/core/crypt"
+	"github.com/abdfnx/tran/models/protocol"
 )
 
 // Sender represents the sender client, handles tranx communication and file transfer.
 type Sender struct {
 	payload      io.Reader
 	payloadSize  int64
+	manifest     *protocol.Manifest
+	selectFiles  func(only []string, compression protocol.Compression) (io.Reader, int64, error)
+	compression  protocol.Compression
+	streams      int
+	segments     *segments
+	streamsReady chan struct{}
+	windowSize   int64
 	senderServer *Server
 	closeServer  chan os.Signal
-	receiverIP   net.IP
+	token        string
 	tranxAddress string
 	tranxPort    int
+	proxy        string
+	timeouts     models.Timeouts
+	direct       models.Direct
+	password     models.PasswordOptions
+	request      models.Password
+	broadcast    models.Password
+	secret       string
+	receivers    int
+	expires      time.Duration
+	joined       chan<- bool
+	phase        protocol.Phase
 	ui           chan<- UIUpdate
 	crypt        *crypt.Crypt
 	state        TransferState
+	transferErr  error
+	claimed      bool
+	mu           sync.Mutex
+	writeMu      sync.Mutex
 }
 
+// expiryGrace is how much longer than the password is valid the sender waits for the receiver,
+// to hear from tranx that the password expired instead of timing out on its own.
+const expiryGrace = 10 * time.Second
+
 // NewSender returns a bare bones Sender.
 func NewSender(programOptions models.TranOptions) *Sender {
 	closeServerCh := make(chan os.Signal, 1)
-	signal.Notify(closeServerCh, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+
+	// the sender waits for the receiver for as long as its password is valid
+	timeouts := programOptions.Timeouts
+	if programOptions.Expires > 0 {
+		timeouts.Rendezvous = programOptions.Expires + expiryGrace
+	}
 
 	return &Sender{
 		closeServer:       closeServerCh,
 		tranxAddress: programOptions.TranxAddress,
 		tranxPort:    programOptions.TranxPort,
+		proxy:        programOptions.Proxy,
+		timeouts:     timeouts,
+		expires:      programOptions.Expires,
+		direct:       programOptions.Direct,
+		password:     programOptions.Password,
+		streams:      programOptions.Streams,
+		compression:  protocol.Compression{Algorithm: protocol.CompressionGzip},
+		streamsReady: make(chan struct{}),
 		state:             Initial,
 	}
 }
@@ -50,14 +90,36 @@ func WithPayload(s *Sender, payload io.Reader, payloadSize int64) *Sender {
 	return s
 }
 
+// WithManifest specifies the manifest that describes the payload to the receiver before it requests it.
+func WithManifest(s *Sender, manifest *protocol.Manifest) *Sender {
+	s.manifest = manifest
+
+	return s
+}
+
+// WithCompression specifies how the payload is compressed, the payload of older senders is compressed with gzip.
+func WithCompression(s *Sender, compression protocol.Compression) *Sender {
+	s.compression = compression
+
+	return s
+}
+
+// WithSelection specifies how the payload of the files matching the patterns a receiver selected is prepared,
+// compressed like the payload. Without it every file is sent and the receiver skips the others.
+func WithSelection(s *Sender, selectFiles func(only []string, compression protocol.Compression) (io.Reader, int64, error)) *Sender {
+	s.selectFiles = selectFiles
+
+	return s
+}
+
 // WithServer specifies the option to run the sender by hosting a server which the receiver establishes a connection to.
 func WithServer(s *Sender, options ServerOptions) *Sender {
-	s.receiverIP = options.receiverIP
+	s.token = options.token
 	router := &http.ServeMux{}
 	s.senderServer = &Server{
 		router: router,
+		listener: options.listener,
 		server: &http.Server{
-			Addr:         fmt.Sprintf(":%d", options.port),
 			ReadTimeout:  30 * time.Second,
 			WriteTimeout: 30 * time.Second,
 			Handler:      router,
@@ -67,6 +129,27 @@ func WithServer(s *Sender, options ServerOptions) *Sender {
 
 	// setup routes
 	router.HandleFunc("/tran", s.handleTransfer())
+	router.HandleFunc("/stream", s.handleStream())
+	return s
+}
+
+// WithRequest specifies the password of the receiver that requested the payload, instead of announcing it with a new password.
+func WithRequest(s *Sender, password models.Password) *Sender {
+	s.request = password
+
+	return s
+}
+
+// WithBroadcast makes the sender one connection of a broadcast of the payload to the supplied number of receivers.
+// The connection announces the broadcast with a new password if password is empty and joins the broadcast otherwise,
+// presenting the secret that tranx told the connection that announced it, see BroadcastSecret.
+// joined is notified once its receiver has joined.
+func WithBroadcast(s *Sender, password models.Password, secret string, receivers int, joined chan<- bool) *Sender {
+	s.broadcast = password
+	s.secret = secret
+	s.receivers = receivers
+	s.joined = joined
+
 	return s
 }
 
@@ -77,14 +160,98 @@ func WithUI(s *Sender, ui chan<- UIUpdate) *Sender {
 	return s
 }
 
+// BroadcastSecret returns the secret of the broadcast the sender announced, once tranx told it.
+func (s *Sender) BroadcastSecret() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.secret
+}
+
 func (s *Sender) TranxAddress() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	return s.tranxAddress
 }
 
 func (s *Sender) TranxPort() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	return s.tranxPort
 }
 
+// setTranx records the tranx server the sender connects to.
+func (s *Sender) setTranx(tranxAddress string, tranxPort int) {
+	s.mu.Lock()
+	s.tranxAddress, s.tranxPort = tranxAddress, tranxPort
+	s.mu.Unlock()
+}
+
+// enterPhase moves the sender to a phase of the transfer, the phase is read by the goroutines that translate errors.
+func (s *Sender) enterPhase(phase protocol.Phase) {
+	s.mu.Lock()
+	s.phase = phase
+	s.mu.Unlock()
+}
+
+// setPhase moves the sender to a phase of the transfer and applies the deadlines of the phase to the connection,
+// the deadlines are serialized with the writes of the other goroutines.
+func (s *Sender) setPhase(wsConn *websocket.Conn, phase protocol.Phase) {
+	s.enterPhase(phase)
+
+	s.writeMu.Lock()
+	tools.SetDeadline(wsConn, s.timeouts.Of(phase))
+	s.writeMu.Unlock()
+}
+
+// phaseError translates an error that occurred in the current phase, see tools.PhaseError.
+func (s *Sender) phaseError(ctx context.Context, err error) error {
+	s.mu.Lock()
+	phase := s.phase
+	s.mu.Unlock()
+
+	return tools.PhaseError(ctx, phase, s.timeouts.Of(phase), err)
+}
+
+// writeMessage encrypts and writes a transfer message, writes are serialized with the abort notification.
+func (s *Sender) writeMessage(wsConn *websocket.Conn, msg protocol.TransferMessage) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	return tools.WriteEncryptedMessage(wsConn, msg, s.crypt)
+}
+
+// abort notifies the receiver that the transfer is aborted because of err,
+// unless no key is established yet or the receiver aborted the transfer itself.
+func (s *Sender) abort(wsConn *websocket.Conn, err error) {
+	var peerErr *protocol.PeerError
+	var stateErr *WrongStateError
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if s.crypt == nil || errors.As(err, &peerErr) {
+		return
+	}
+
+	payload := tools.NewTransferErrorPayload(err)
+	if errors.As(err, &stateErr) {
+		payload = protocol.TransferErrorPayload{Code: protocol.ErrorUnsynchronized, Message: stateErr.Error()}
+	}
+
+	tools.WriteTransferError(wsConn, s.crypt, payload)
+}
+
+// abortOnDone aborts the transfer and closes the connection once ctx is done, until the returned stop function is called.
+func (s *Sender) abortOnDone(ctx context.Context, wsConn *websocket.Conn) (stop func()) {
+	return tools.OnDone(ctx, func() {
+		s.abort(wsConn, ctx.Err())
+		wsConn.Close()
+	})
+}
+
 // updateUI is a helper function that checks if we have a UI channel and reports the state.
 func (s *Sender) updateUI(progress ...float32) {
 	if s.ui == nil {
@@ -99,3 +266,12 @@ func (s *Sender) updateUI(progress ...float32) {
 
 	s.ui <- UIUpdate{State: s.state, Progress: p}
 }
+
+// updateProgress reports the progress the receiver acknowledged and the estimated time left, while the payload is sent.
+func (s *Sender) updateProgress(progress float32, eta time.Duration) {
+	if s.ui == nil {
+		return
+	}
+
+	s.ui <- UIUpdate{State: SendingData, Progress: progress, ETA: eta}
+}
@@ -2,7 +2,6 @@ package sender
 
 import (
 	"fmt"
-	"log"
 	"net"
 	"time"
 	"syscall"
@@ -15,40 +14,63 @@ import (
 // Server specifies the webserver that will be used for direct file transfer.
 type Server struct {
 	server   *http.Server
+	listener net.Listener
 	router   *http.ServeMux
 	upgrader websocket.Upgrader
 }
 
 // Specifies the necessary options for initializing the webserver.
 type ServerOptions struct {
-	port       int
-	receiverIP net.IP
+	listener net.Listener
+	token    string
 }
 
-// Start starts the sender.Server webserver and setups graceful shutdown
-func (s *Sender) StartServer() error {
+// StartServer starts the sender.Server webserver and setups graceful shutdown.
+// It returns once the server is closed or ctx is done, reporting the error of a direct transfer if one failed.
+func (s *Sender) StartServer(ctx context.Context) error {
 	if s.senderServer == nil {
 		return fmt.Errorf("start called with uninitialized senderServer")
 	}
 
-	// context used for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
+	// context used for graceful shutdown, transfers started by the server abort with it
+	serverCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.senderServer.server.BaseContext = func(net.Listener) context.Context {
+		return serverCtx
+	}
 
 	go func() {
-		<-s.closeServer
-		cancel()
+		select {
+			case <-s.closeServer:
+				cancel()
+
+			case <-serverCtx.Done():
+		}
 	}()
 
 	// serve the webserver, and report errors
-	if err := serve(s, ctx); err != nil {
+	if err := serve(s, serverCtx); err != nil {
 		return err
 	}
 
-	return nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the server was shut down from the outside, not by a finished transfer
+	if s.transferErr == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return s.transferErr
 }
 
+// CloseServer requests the shutdown of the sender.Server webserver, it never blocks.
 func (s *Sender) CloseServer() {
-	s.closeServer <- syscall.SIGTERM
+	select {
+		case s.closeServer <- syscall.SIGTERM:
+		default:
+	}
 }
 
 // serve is helper function that serves the webserver while providing graceful shutdown.
@@ -57,13 +79,21 @@ func serve(s *Sender, ctx context.Context) (err error) {
 		return fmt.Errorf("serve called with uninitialized senderServer")
 	}
 
+	serveErr := make(chan error, 1)
+
 	go func() {
-		if err = s.senderServer.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Tran sender-server crashed due to an error: %s\n", err)
+		if err := s.senderServer.server.Serve(s.senderServer.listener); err != nil && err != http.ErrServerClosed {
+			serveErr <- err
 		}
 	}()
 
-	<-ctx.Done() // wait for the shutdown sequence to start.
+	// wait for the shutdown sequence to start.
+	select {
+		case <-ctx.Done():
+
+		case err := <-serveErr:
+			return fmt.Errorf("tran sender-server crashed due to an error: %w", err)
+	}
 
 	ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer func() {
@@ -72,7 +102,7 @@ func serve(s *Sender, ctx context.Context) (err error) {
 
 	// shutdown and report errors
 	if err = s.senderServer.server.Shutdown(ctxShutdown); err != nil {
-		log.Fatalf("Tran shutdown sequence failed to due error: %s\n", err)
+		return fmt.Errorf("tran shutdown sequence failed due to error: %w", err)
 	}
 
 	// strip error in this case, as we deal with this gracefully
@@ -1,6 +1,11 @@
 package sender
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+
+	"github.com/abdfnx/tran/models/protocol"
+)
 
 type TransferState int
 
@@ -17,6 +22,7 @@ const (
 type UIUpdate struct {
 	State    TransferState
 	Progress float32
+	ETA      time.Duration // estimated time until the receiver has received the payload, zero if unknown
 }
 
 // WrongStateError is a custom error for the Transfer sequence
@@ -62,3 +68,18 @@ func (s TransferState) Name() string {
 			return ""
 	}
 }
+
+// Phase returns the phase of the transfer the state belongs to.
+func (s TransferState) Phase() protocol.Phase {
+	switch s {
+		// the receiver reviews the manifest before it requests the payload
+		case WaitForFileRequest:
+			return protocol.PhaseReview
+
+		case WaitForCloseMessage, WaitForCloseAck:
+			return protocol.PhaseClose
+
+		default:
+			return protocol.PhaseTransfer
+	}
+}
@@ -0,0 +1,293 @@
+package sender
+
+import (
+	"io"
+	"fmt"
+	"sync"
+	"errors"
+	"runtime"
+	"net/http"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/constants"
+	"github.com/abdfnx/tran/core/crypt"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// segments hands out the ranges of the payload to the streams sending it, every range is taken once.
+type segments struct {
+	size    int64
+	window  *window
+	next    int64
+	sent    int64
+	joined  map[int]bool
+	closed  bool
+	err     error
+	streams sync.WaitGroup
+	mu      sync.Mutex
+}
+
+func newSegments(size int64, window *window) *segments {
+	return &segments{size: size, window: window, joined: map[int]bool{}}
+}
+
+// take returns the next range of the payload, it reports false once every range was taken or a stream failed.
+func (q *segments) take() (int64, int64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.next >= q.size || q.err != nil {
+		return 0, 0, false
+	}
+
+	offset, size := q.next, int64(constants.STREAM_SEGMENT_BYTES)
+	if offset + size > q.size {
+		size = q.size - offset
+	}
+
+	q.next += size
+
+	return offset, size, true
+}
+
+// progress counts n bytes as sent and returns the progress of the whole payload.
+func (q *segments) progress(n int) float32 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.sent += int64(n)
+
+	return float32(q.sent) / float32(q.size)
+}
+
+// join registers stream, it reports false if the stream joined already or the payload is sent already.
+func (q *segments) join(stream int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed || q.joined[stream] {
+		return false
+	}
+
+	q.joined[stream] = true
+	q.streams.Add(1)
+
+	return true
+}
+
+// leave unregisters a stream, a stream that failed fails the transfer as the ranges it took are lost.
+func (q *segments) leave(err error) {
+	q.mu.Lock()
+	if err != nil && q.err == nil {
+		q.err = err
+	}
+	q.mu.Unlock()
+
+	q.streams.Done()
+}
+
+// close stops further streams from joining, waits for the joined ones and returns the error of the first one that failed.
+func (q *segments) close() error {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+
+	q.streams.Wait()
+
+	return q.err
+}
+
+// streamOffer returns the number of parallel streams the sender server accepts, zero if the payload can not be sent in segments.
+func (s *Sender) streamOffer() int {
+	if _, ok := s.payload.(io.ReaderAt); !ok {
+		return 0
+	}
+
+	switch {
+		case s.streams > 0:
+			return s.streams
+
+		// further streams help as long as there are cores to encrypt on
+		case runtime.NumCPU() < constants.MAX_STREAMS:
+			return runtime.NumCPU()
+
+		default:
+			return constants.MAX_STREAMS
+	}
+}
+
+// streamSegmented sends the payload in segments over wsConn, the stream zero, and the streams the receiver opens meanwhile,
+// all of them as far as the window allows. It returns once every segment was sent, the receiver must not send anything
+// but acknowledgements and a TransferError meanwhile, which is read on next.
+func (s *Sender) streamSegmented(wsConn *websocket.Conn, next <-chan readResult, window *window) error {
+	if _, ok := s.payload.(io.ReaderAt); !ok {
+		return fmt.Errorf("the payload can not be sent in segments")
+	}
+
+	stream, err := s.crypt.Stream(0)
+	if err != nil {
+		return err
+	}
+
+	queue := newSegments(s.payloadSize, window)
+	queue.join(0)
+
+	s.mu.Lock()
+	s.segments = queue
+	s.mu.Unlock()
+	close(s.streamsReady)
+
+	err = s.sendSegments(wsConn, stream, queue, next, &s.writeMu)
+	queue.leave(err)
+
+	if streamsErr := queue.close(); err == nil {
+		err = streamsErr
+	}
+
+	return err
+}
+
+// sendSegments sends the segments it takes from queue over wsConn until all are taken, writes are serialized with writeMu.
+func (s *Sender) sendSegments(wsConn *websocket.Conn, stream *crypt.Stream, queue *segments, next <-chan readResult, writeMu *sync.Mutex) error {
+	reader := s.payload.(io.ReaderAt)
+	buffer := make([]byte, ChunkSize(s.payloadSize))
+
+	write := func(data []byte) error {
+		enc, err := stream.Encrypt(data)
+		if err != nil {
+			return err
+		}
+
+		writeMu.Lock()
+		defer writeMu.Unlock()
+
+		tools.SetDeadline(wsConn, s.timeouts.Of(protocol.PhaseTransfer))
+
+		return wsConn.WriteMessage(websocket.BinaryMessage, enc)
+	}
+
+	for {
+		select {
+			case received := <-next:
+				return receivedError(received)
+
+			default:
+		}
+
+		offset, size, ok := queue.take()
+		if !ok {
+			return nil
+		}
+
+		header, err := json.Marshal(protocol.TransferMessage{
+			Type:    protocol.SenderSegment,
+			Payload: protocol.SegmentPayload{Offset: offset, Size: size},
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if err := write(header); err != nil {
+			return s.writeError(wsConn, next, err)
+		}
+
+		for sent := int64(0); sent < size; {
+			chunk := buffer
+			if remaining := size - sent; remaining < int64(len(chunk)) {
+				chunk = chunk[:remaining]
+			}
+
+			n, err := reader.ReadAt(chunk, offset + sent)
+			if err != nil && !(errors.Is(err, io.EOF) && n == len(chunk)) {
+				return fmt.Errorf("error reading the payload: %w", err)
+			}
+
+			// wait for the receiver to catch up, only the stream zero learns why it stopped acknowledging
+			if !queue.window.reserve(int64(n)) {
+				select {
+					case received := <-next:
+						return receivedError(received)
+
+					default:
+						return errAcksStopped
+				}
+			}
+
+			if err := write(chunk[:n]); err != nil {
+				return s.writeError(wsConn, next, err)
+			}
+
+			// the progress is the one acknowledged if the receiver acknowledges
+			sent += int64(n)
+			if progress := queue.progress(n); queue.window.size == 0 {
+				s.updateUI(progress)
+			}
+		}
+	}
+}
+
+// handleStream creates a HandlerFunc to handle a further stream the receiver opens while the payload is sent in segments.
+func (s *Sender) handleStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// only the receiver of the transfer that started learned the token
+		if !tools.HasToken(r, s.token) || !s.isClaimed() {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "No Tran for You!")
+
+			return
+		}
+
+		wsConn, err := s.senderServer.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer wsConn.Close()
+
+		// the receiver proves that it knows the key of the transfer
+		tools.SetDeadline(wsConn, s.timeouts.Of(protocol.PhaseHandshake))
+		msg, err := tools.ReadEncryptedMessage(wsConn, s.crypt)
+		if err != nil || msg.Type != protocol.ReceiverStream {
+			return
+		}
+
+		streamPayload := protocol.StreamPayload{}
+		err = tools.DecodePayload(msg.Payload, &streamPayload)
+		if err != nil || streamPayload.Stream < 1 || streamPayload.Stream >= s.streamOffer() {
+			return
+		}
+
+		stream, err := s.crypt.Stream(uint32(streamPayload.Stream))
+		if err != nil {
+			return
+		}
+
+		select {
+			case <-s.streamsReady:
+
+			case <-r.Context().Done():
+				return
+		}
+
+		s.mu.Lock()
+		queue := s.segments
+		s.mu.Unlock()
+
+		// a stream that opens after every segment was sent has nothing to do
+		if !queue.join(streamPayload.Stream) {
+			tools.WriteEncryptedMessage(wsConn, protocol.TransferMessage{Type: protocol.SenderStreamDone}, stream)
+			return
+		}
+
+		// the stream is done once the receiver was told so, before the payload is announced as sent on the stream zero
+		err = s.sendSegments(wsConn, stream, queue, s.readNext(wsConn), &sync.Mutex{})
+		if err == nil {
+			err = tools.WriteEncryptedMessage(wsConn, protocol.TransferMessage{Type: protocol.SenderStreamDone}, stream)
+		}
+
+		queue.leave(err)
+	}
+}
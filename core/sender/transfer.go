@@ -3,9 +3,9 @@ package sender
 import (
 	"io"
 	"fmt"
-	"log"
-	"bufio"
-	"syscall"
+	"time"
+	"errors"
+	"context"
 
 	"github.com/gorilla/websocket"
 	"github.com/abdfnx/tran/tools"
@@ -14,16 +14,45 @@ import (
 )
 
 // Transfer is the file transfer sequence, can be via relay or tranx.
-func (s *Sender) Transfer(wsConn *websocket.Conn) error {
+// The connection is closed once the sequence ends or ctx is done, closing the server is up to the caller.
+// The receiver is notified with a TransferError if the transfer is aborted on this side.
+func (s *Sender) Transfer(ctx context.Context, wsConn *websocket.Conn) error {
+	return s.transferFrom(ctx, wsConn, nil)
+}
+
+// transferFrom runs the transfer sequence, starting with the message already read on first if it is set.
+func (s *Sender) transferFrom(ctx context.Context, wsConn *websocket.Conn, first <-chan readResult) error {
+	defer wsConn.Close()
+	stop := s.abortOnDone(ctx, wsConn)
+	defer stop()
+
+	err := s.transfer(ctx, wsConn, first)
+	if err != nil && ctx.Err() == nil {
+		s.abort(wsConn, err)
+	}
+
+	return err
+}
+
+// transfer serves the receiver, next is set while a message is read in the background.
+func (s *Sender) transfer(ctx context.Context, wsConn *websocket.Conn, next <-chan readResult) error {
 	s.state = WaitForFileRequest
 
 	for {
 		// Read incoming message.
-		receivedMsg, err := tools.ReadEncryptedMessage(wsConn, s.crypt)
+		s.setPhase(wsConn, s.state.Phase())
+		receivedMsg, err := s.readMessage(wsConn, next)
+		next = nil
+
+		var peerErr *protocol.PeerError
+		if errors.As(err, &peerErr) {
+			s.updateUI()
+
+			return err
+		}
+
 		if err != nil {
-			wsConn.Close()
-			s.closeServer <- syscall.SIGTERM
-			return fmt.Errorf("shutting down tran due to websocket error: %s", err)
+			return fmt.Errorf("shutting down tran due to websocket error: %w", s.phaseError(ctx, err))
 		}
 
 		// main switch for action based on incoming message.
@@ -31,35 +60,46 @@ func (s *Sender) Transfer(wsConn *websocket.Conn) error {
 		switch receivedMsg.Type {
 			case protocol.ReceiverRequestPayload:
 				if s.state != WaitForFileRequest {
-					err = tools.WriteEncryptedMessage(wsConn, protocol.TransferMessage{
-						Type:    protocol.TransferError,
-						Payload: fmt.Sprintf("Tran unsynchronized, expected state: %s, actual: %s", WaitForFileRequest.Name(), s.state.Name()),
-					}, s.crypt)
+					return NewWrongStateError(WaitForFileRequest, s.state)
+				}
 
-					if err != nil {
-						return err
-					}
+				request := protocol.RequestPayload{}
+				if err := tools.DecodePayload(receivedMsg.Payload, &request); err != nil {
+					return err
+				}
+
+				if err := s.selectPayload(wsConn, request); err != nil {
+					return s.phaseError(ctx, err)
+				}
 
-					wsConn.Close()
-					s.closeServer <- syscall.SIGTERM
+				s.state = SendingData
 
-					return NewWrongStateError(WaitForFileRequest, s.state)
+				// receivers of older versions do not acknowledge the payload, which is sent as fast as it can be written then
+				window := newWindow(0, s.payloadSize)
+				if request.Acks {
+					window = newWindow(s.windowSize, s.payloadSize)
 				}
 
-				err = s.streamPayload(wsConn)
-				if err != nil {
-					log.Println("error in payload streaming:", err)
+				// keep reading while streaming, so an abort of the receiver is noticed right away
+				next = s.readAcks(wsConn, window)
 
-					return err
+				// receivers of older versions take the payload in one piece
+				if request.Streams > 0 {
+					err = s.streamSegmented(wsConn, next, window)
+				} else {
+					err = s.streamPayload(wsConn, next, window)
+				}
+				if err != nil {
+					return fmt.Errorf("error in payload streaming: %w", s.phaseError(ctx, err))
 				}
 
-				err = tools.WriteEncryptedMessage(wsConn, protocol.TransferMessage{
+				err = s.writeMessage(wsConn, protocol.TransferMessage{
 					Type:    protocol.SenderPayloadSent,
 					Payload: "Tran transfer completed",
-				}, s.crypt)
+				})
 
 				if err != nil {
-					return err
+					return s.phaseError(ctx, err)
 				}
 
 				s.state = WaitForFileAck
@@ -67,84 +107,177 @@ func (s *Sender) Transfer(wsConn *websocket.Conn) error {
 
 			case protocol.ReceiverPayloadAck:
 				if s.state != WaitForFileAck {
-					err = tools.WriteEncryptedMessage(wsConn, protocol.TransferMessage{
-						Type:    protocol.TransferError,
-						Payload: fmt.Sprintf("Tran unsynchronized, expected state: %s, actual: %s", WaitForFileAck.Name(), s.state.Name()),
-					}, s.crypt)
-
-					if err != nil {
-						return err
-					}
-
-					wsConn.Close()
-					s.closeServer <- syscall.SIGTERM
-
 					return NewWrongStateError(WaitForFileAck, s.state)
 				}
 
 				s.state = WaitForCloseMessage
 				s.updateUI()
 
-				err = tools.WriteEncryptedMessage(wsConn, protocol.TransferMessage{
+				err = s.writeMessage(wsConn, protocol.TransferMessage{
 					Type:    protocol.SenderClosing,
 					Payload: "Closing down Tran as requested",
-				}, s.crypt)
+				})
 
 				if err != nil {
-					return err
+					return s.phaseError(ctx, err)
 				}
 
 				s.state = WaitForCloseAck
 				s.updateUI()
 
 			case protocol.ReceiverClosingAck:
-				wsConn.Close()
-				s.closeServer <- syscall.SIGTERM
-
 				if s.state != WaitForCloseAck {
 					return NewWrongStateError(WaitForCloseAck, s.state)
 				}
 
 				return nil
+		}
+	}
+}
 
-			case protocol.TransferError:
-				s.updateUI()
-				log.Println("Shutting down Tran due to a transfer error")
-				wsConn.Close()
-				s.closeServer <- syscall.SIGTERM
+// selectPayload replaces the payload by the one of the files the receiver selected in its request, if it selected some,
+// and announces its size to the receiver.
+func (s *Sender) selectPayload(wsConn *websocket.Conn, request protocol.RequestPayload) error {
+	if len(request.Only) == 0 || s.selectFiles == nil {
+		return nil
+	}
 
-				return fmt.Errorf("TransferError during file transfer")
-		}
+	if err := tools.ValidatePatterns(request.Only); err != nil {
+		return err
+	}
+
+	payload, payloadSize, err := s.selectFiles(request.Only, s.compression)
+	if err != nil {
+		return fmt.Errorf("error preparing the selected files: %w", err)
+	}
+
+	s.payload, s.payloadSize = payload, payloadSize
+
+	return s.writeMessage(wsConn, protocol.TransferMessage{
+		Type:    protocol.SenderPayloadSelected,
+		Payload: protocol.SelectedPayload{PayloadSize: payloadSize},
+	})
+}
+
+// readResult is the outcome of reading a message from the receiver.
+type readResult struct {
+	msg protocol.TransferMessage
+	err error
+}
+
+// readNext reads the next message of the receiver in the background.
+func (s *Sender) readNext(wsConn *websocket.Conn) <-chan readResult {
+	next := make(chan readResult, 1)
+
+	go func() {
+		msg, err := tools.ReadEncryptedMessage(wsConn, s.crypt)
+		next <- readResult{msg: msg, err: err}
+	}()
+
+	return next
+}
+
+// readMessage returns the message read in the background by next, or reads one if next is nil.
+func (s *Sender) readMessage(wsConn *websocket.Conn, next <-chan readResult) (protocol.TransferMessage, error) {
+	if next == nil {
+		return tools.ReadEncryptedMessage(wsConn, s.crypt)
 	}
+
+	received := <-next
+
+	return received.msg, received.err
 }
 
 // streamPayload streams the payload over the provided websocket connection while reporting the progress.
-func (s *Sender) streamPayload(wsConn *websocket.Conn) error {
-	bufReader := bufio.NewReader(s.payload)
+// The chunks are read ahead and encrypted in parallel, see tools.Pipeline, and written in order as far as the window allows.
+// Every chunk has to be written within the timeout of the transfer phase, the receiver must not send anything
+// but acknowledgements and a TransferError meanwhile, which is read on next.
+func (s *Sender) streamPayload(wsConn *websocket.Conn, next <-chan readResult, window *window) error {
 	chunkSize := ChunkSize(s.payloadSize)
-	buffer := make([]byte, chunkSize)
+	pipeline := tools.NewPipeline(s.crypt.Encrypt)
+
+	var readErr error
+	readDone := make(chan struct{})
+
+	go func() {
+		defer close(readDone)
+		defer pipeline.CloseInput()
+
+		for {
+			buffer := make([]byte, chunkSize)
+			n, err := io.ReadFull(s.payload, buffer)
+
+			if n > 0 && pipeline.Push(buffer[:n]) == nil {
+				return
+			}
+
+			if err != nil {
+				if err != io.EOF && err != io.ErrUnexpectedEOF {
+					readErr = fmt.Errorf("error reading the payload: %w", err)
+				}
+
+				return
+			}
+		}
+	}()
+
+	defer func() {
+		pipeline.Stop()
+		<-readDone
+	}()
 
 	var bytesSent int
 
 	for {
-		n, err := bufReader.Read(buffer)
-		bytesSent += n
-		enc, encErr := s.crypt.Encrypt(buffer[:n])
+		select {
+			case received := <-next:
+				return receivedError(received)
+
+			default:
+		}
+
+		chunk, ok := pipeline.Next()
+		if !ok {
+			return readErr
+		}
 
+		enc, encErr := chunk.Result()
 		if encErr != nil {
 			return encErr
 		}
 
-		wsConn.WriteMessage(websocket.BinaryMessage, enc)
-		progress := float32(bytesSent) / float32(s.payloadSize)
-		s.updateUI(progress)
+		// wait for the receiver to catch up
+		if !window.reserve(int64(chunk.Len())) {
+			return receivedError(<-next)
+		}
+
+		s.setPhase(wsConn, protocol.PhaseTransfer)
+		s.writeMu.Lock()
+		writeErr := wsConn.WriteMessage(websocket.BinaryMessage, enc)
+		s.writeMu.Unlock()
+
+		if writeErr != nil {
+			return s.writeError(wsConn, next, writeErr)
+		}
 
-		if err == io.EOF {
-			break
+		// the progress is the one acknowledged if the receiver acknowledges
+		bytesSent += chunk.Len()
+		if window.size == 0 {
+			s.updateUI(float32(bytesSent) / float32(s.payloadSize))
 		}
 	}
+}
+
+// writeError returns the reason of the receiver if it aborted the transfer, which is read on next, and writeErr otherwise.
+func (s *Sender) writeError(wsConn *websocket.Conn, next <-chan readResult, writeErr error) error {
+	var peerErr *protocol.PeerError
+
+	wsConn.SetReadDeadline(time.Now().Add(time.Second))
+	if received := <-next; errors.As(received.err, &peerErr) {
+		return received.err
+	}
 
-	return nil
+	return writeErr
 }
 
 // ChunkSize returns an appropriate chunk size for the payload size
@@ -0,0 +1,202 @@
+package sender
+
+import (
+	"io"
+	"bytes"
+	"testing"
+	"net/http"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/cipher"
+	"net/http/httptest"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models"
+	"github.com/abdfnx/tran/constants"
+	"github.com/abdfnx/tran/core/crypt"
+)
+
+// benchPayloadSize is the size of the payload the benchmarks encrypt and stream per operation.
+const benchPayloadSize = 16 * constants.MAX_CHUNK_BYTES
+
+// perChunkEncrypt encrypts like Crypt.Encrypt did before the AEAD was shared, it creates the AEAD for every chunk.
+func perChunkEncrypt(key []byte, unencrypted []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aescgm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aescgm.Seal(nonce, nonce, unencrypted, nil), nil
+}
+
+// streamSequentially streams the payload like streamPayload did before the pipeline,
+// it reads, encrypts and writes one chunk after the other.
+func streamSequentially(s *Sender, wsConn *websocket.Conn) error {
+	buffer := make([]byte, ChunkSize(s.payloadSize))
+
+	for {
+		n, err := io.ReadFull(s.payload, buffer)
+
+		if n > 0 {
+			enc, encErr := perChunkEncrypt(s.crypt.Key, buffer[:n])
+			if encErr != nil {
+				return encErr
+			}
+
+			if err := wsConn.WriteMessage(websocket.BinaryMessage, enc); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// dialSink connects to a websocket server that discards the messages it receives.
+func dialSink(b *testing.B) *websocket.Conn {
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer wsConn.Close()
+
+		for {
+			_, reader, err := wsConn.NextReader()
+			if err != nil {
+				return
+			}
+
+			io.Copy(io.Discard, reader)
+		}
+	}))
+
+	b.Cleanup(server.Close)
+
+	wsConn, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[len("http"):], nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Cleanup(func() { wsConn.Close() })
+
+	return wsConn
+}
+
+// benchPayload returns a random payload and the crypt of a session.
+func benchPayload(b *testing.B) ([]byte, *crypt.Crypt) {
+	payload := make([]byte, benchPayloadSize)
+	rand.Read(payload)
+
+	c, err := crypt.New([]byte("the session key of the transfer"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return payload, c
+}
+
+func BenchmarkEncrypt(b *testing.B) {
+	payload, c := benchPayload(b)
+
+	b.Run("per chunk AEAD", func(b *testing.B) {
+		b.SetBytes(benchPayloadSize)
+
+		for i := 0; i < b.N; i++ {
+			for sent := 0; sent < len(payload); sent += constants.MAX_CHUNK_BYTES {
+				if _, err := perChunkEncrypt(c.Key, payload[sent:sent + constants.MAX_CHUNK_BYTES]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("shared AEAD", func(b *testing.B) {
+		b.SetBytes(benchPayloadSize)
+
+		for i := 0; i < b.N; i++ {
+			for sent := 0; sent < len(payload); sent += constants.MAX_CHUNK_BYTES {
+				if _, err := c.Encrypt(payload[sent:sent + constants.MAX_CHUNK_BYTES]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("pipeline", func(b *testing.B) {
+		b.SetBytes(benchPayloadSize)
+
+		for i := 0; i < b.N; i++ {
+			pipeline := tools.NewPipeline(c.Encrypt)
+
+			go func() {
+				defer pipeline.CloseInput()
+
+				for sent := 0; sent < len(payload); sent += constants.MAX_CHUNK_BYTES {
+					pipeline.Push(payload[sent:sent + constants.MAX_CHUNK_BYTES])
+				}
+			}()
+
+			for chunk, ok := pipeline.Next(); ok; chunk, ok = pipeline.Next() {
+				if _, err := chunk.Result(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkStreamPayload(b *testing.B) {
+	payload, c := benchPayload(b)
+
+	newSender := func() *Sender {
+		s := WithPayload(NewSender(models.TranOptions{}), bytes.NewReader(payload), benchPayloadSize)
+		s.crypt = c
+
+		return s
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		wsConn := dialSink(b)
+		b.SetBytes(benchPayloadSize)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if err := streamSequentially(newSender(), wsConn); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("pipeline", func(b *testing.B) {
+		wsConn := dialSink(b)
+		b.SetBytes(benchPayloadSize)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if err := newSender().streamPayload(wsConn, nil, newWindow(0, benchPayloadSize)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
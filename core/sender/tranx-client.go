@@ -3,6 +3,8 @@ package sender
 import (
 	"fmt"
 	"net"
+	"time"
+	"context"
 
 	"github.com/schollz/pake/v3"
 	"github.com/gorilla/websocket"
@@ -12,16 +14,19 @@ import (
 	"github.com/abdfnx/tran/models/protocol"
 )
 
-// ConnectToTranx, establishes the connection with the tranx server.
+// ConnectToTranx, establishes the connection with the tranx server, which TranxAddress and TranxPort report from then on.
 // Parameters:
+// ctx              -   context that aborts the communication when done.
 // tranxAddress 	-   IP or hostname of the tranx server
 // tranxPort 		- 	port of the tranx server
+// passwordCh       -   channel to communicate the password to the caller, unused if the caller knows the password already.
 // startServerCh    -   channel to communicate to the caller when to start the server, and with which options.
-// passwordCh       -   channel to communicate the password to the caller.
-// startServerCh    -   channel to communicate to the caller when to start the server, and with which options.
+//                      The transfer is relayed through tranx if it is nil.
 // payloadReady    	-   channel over which the caller can communicate when the payload is ready.
-// relayCh         	-   channel to communicated if we are using relay (tranx) for transfer.
+// relayCh         	-   channel to communicate the connection to transfer over, if it is not one to the sender server:
+//                      the tranx connection relaying the transfer, or a connection to the receiver. Closed otherwise.
 func (s *Sender) ConnectToTranx(
+	ctx context.Context,
 	tranxAddress string,
 	tranxPort int,
 	passwordCh chan<- models.Password,
@@ -30,78 +35,238 @@ func (s *Sender) ConnectToTranx(
 	relayCh chan<- *websocket.Conn,
 ) error {
 	// establish websocket connection to tranx server
-	wsConn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s:%d/establish-sender", tranxAddress, tranxPort), nil)
+	s.setTranx(tranxAddress, tranxPort)
+	s.enterPhase(protocol.PhaseConnect)
+	dialCtx, cancel := tools.WithTimeout(ctx, s.timeouts.Of(protocol.PhaseConnect))
+	path := "establish-sender"
+
+	switch {
+		case s.request != "":
+			path = "establish-requested-sender"
+
+		case s.broadcast != "":
+			path = "establish-broadcast-sender"
+	}
+
+	wsConn, _, err := tools.TranxDialer(s.proxy).DialContext(dialCtx, fmt.Sprintf("ws://%s:%d/%s", tranxAddress, tranxPort, path), nil)
+	cancel()
+
 	if err != nil {
-		return err
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return &protocol.UnreachableError{Address: fmt.Sprintf("%s:%d", tranxAddress, tranxPort), Err: s.phaseError(ctx, err)}
 	}
 
-	// bind connection
-	tranxMsg, err := tools.ReadTranxMessage(wsConn, protocol.TranxToSenderBind)
+	stop := s.abortOnDone(ctx, wsConn)
+	defer stop()
+
+	transferConn, err := s.negotiate(ctx, wsConn, passwordCh, payloadReady, startServerCh)
 	if err != nil {
+		err = s.phaseError(ctx, err)
+		if ctx.Err() == nil {
+			s.abort(wsConn, err)
+		}
+
+		wsConn.Close()
+
 		return err
 	}
 
-	bindPayload := protocol.TranxToSenderBindPayload{}
-	err = tools.DecodePayload(tranxMsg.Payload, &bindPayload)
+	if transferConn == nil {
+		close(relayCh)
+
+		return nil
+	}
+
+	// when transferring over a connection to the receiver, tranx closes its connection once the receiver asks for it
+	relayCh <- transferConn
+
+	return nil
+}
+
+// negotiate establishes the sender on the tranx server and returns the connection chosen for the transfer, see chooseTransport.
+func (s *Sender) negotiate(ctx context.Context, wsConn *websocket.Conn, passwordCh chan<- models.Password,
+	payloadReady <-chan bool, startServerCh chan<- ServerOptions) (*websocket.Conn, error) {
+	err := s.establishTranx(ctx, wsConn, passwordCh, payloadReady, startServerCh)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return s.chooseTransport(ctx, wsConn, startServerCh != nil)
+}
+
+// chooseTransport reads how the receiver wants to receive the payload and returns the connection to transfer it over:
+// wsConn if it keeps using the connection, or if served is set and the sender server runs,
+// nil if the receiver connects to it and a connection to the receiver if the receiver asks the sender to connect to it.
+func (s *Sender) chooseTransport(ctx context.Context, wsConn *websocket.Conn, served bool) (*websocket.Conn, error) {
+	s.setPhase(wsConn, protocol.PhaseHandshake)
+	transferMsg, err := tools.ReadEncryptedMessage(wsConn, s.crypt)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := []protocol.TransferMessageType{protocol.ReceiverRelayCommunication}
+	if served {
+		expected = append(expected, protocol.ReceiverDirectCommunication, protocol.ReceiverReverseCommunication)
+	}
+
+	switch transferMsg.Type {
+		// we will do direct communication with the receiver
+		case protocol.ReceiverDirectCommunication:
+			if !served {
+				return nil, protocol.NewWrongMessageTypeError(expected, transferMsg.Type)
+			}
+
+			if err = s.writeMessage(wsConn, protocol.TransferMessage{Type: protocol.SenderDirectAck}); err != nil {
+				return nil, err
+			}
+
+			return nil, nil
+
+		// we will do relay communication with receiver using the same websocket connection as with tranx
+		case protocol.ReceiverRelayCommunication:
+			if err = s.writeMessage(wsConn, protocol.TransferMessage{Type: protocol.SenderRelayAck}); err != nil {
+				return nil, err
+			}
+
+			return wsConn, nil
+
+		// the receiver could not reach the server of the sender, we try to reach the receiver instead
+		case protocol.ReceiverReverseCommunication:
+			if !served {
+				return nil, protocol.NewWrongMessageTypeError(expected, transferMsg.Type)
+			}
+
+			return s.connectReverse(ctx, wsConn, transferMsg)
+
+		default:
+			return nil, protocol.NewWrongMessageTypeError(expected, transferMsg.Type)
+	}
+}
+
+// establishTranx binds the sender on the tranx server, waits for the receiver and does the key exchange and handshake.
+// If the receiver requested the payload or the sender joins its own broadcast, it uses the password it knows instead.
+func (s *Sender) establishTranx(ctx context.Context, wsConn *websocket.Conn, passwordCh chan<- models.Password,
+	payloadReady <-chan bool, startServerCh chan<- ServerOptions) error {
+	s.setPhase(wsConn, protocol.PhaseConnect)
+	password := s.request
+	if s.broadcast != "" {
+		password = s.broadcast
+	}
+
+	if password == "" {
+		var err error
+
+		password, err = s.bind(wsConn)
+		if err != nil {
+			return err
+		}
 	}
 
 	// establish sender
-	password := tools.GeneratePassword(bindPayload.ID)
 	hashed := tools.HashPassword(password)
 
-	wsConn.WriteJSON(protocol.TranxMessage{
+	err := wsConn.WriteJSON(protocol.TranxMessage{
 		Type: protocol.SenderToTranxEstablish,
 		Payload: protocol.PasswordPayload{
-			Password: hashed,
+			Password:  hashed,
+			Receivers: s.receivers,
+			Expires:   int(s.expires / time.Second),
+			Secret:    s.secret,
 		},
 	})
 
-	// send the generated password to the UI so it can be displayed
-	passwordCh <- password
+	if err != nil {
+		return err
+	}
+
+	// the further connections of a broadcast join it with the secret tranx tells the connection that announces it
+	if s.request == "" && s.broadcast == "" && s.receivers > 1 {
+		if err = s.readBroadcastSecret(wsConn); err != nil {
+			return err
+		}
+	}
+
+	// send the generated password to the UI so it can be displayed, the receiver that requested the payload knows it
+	if s.request == "" && s.broadcast == "" {
+		passwordCh <- password
+	}
 
 	// setup the encryption
-	err = s.establishSecureConnection(wsConn, password)
+	err = s.establishSecureConnection(wsConn, password, tranxKeyExchange)
 	if err != nil {
 		return err
 	}
 
 	// do the transfer handshake over the tranx
-	err = s.doHandshake(wsConn, payloadReady, startServerCh)
+	return s.doHandshake(ctx, wsConn, payloadReady, startServerCh)
+}
+
+// bind reads the ID tranx bound to the connection and generates the password with it.
+func (s *Sender) bind(wsConn *websocket.Conn) (models.Password, error) {
+	tranxMsg, err := tools.ReadTranxMessage(wsConn, protocol.TranxToSenderBind)
+	if err != nil {
+		return "", err
+	}
+
+	bindPayload := protocol.TranxToSenderBindPayload{}
+	err = tools.DecodePayload(tranxMsg.Payload, &bindPayload)
+	if err != nil {
+		return "", err
+	}
+
+	return tools.GeneratePassword(bindPayload.ID, s.password)
+}
+
+// readBroadcastSecret reads the secret of the broadcast the sender announced.
+func (s *Sender) readBroadcastSecret(wsConn *websocket.Conn) error {
+	tranxMsg, err := tools.ReadTranxMessage(wsConn, protocol.TranxToSenderBroadcast)
 	if err != nil {
 		return err
 	}
 
-	transferMsg, err := tools.ReadEncryptedMessage(wsConn, s.crypt)
+	broadcastPayload := protocol.TranxToSenderBroadcastPayload{}
+	err = tools.DecodePayload(tranxMsg.Payload, &broadcastPayload)
 	if err != nil {
 		return err
 	}
 
-	switch transferMsg.Type {
-	// we will do direct communication with the receiver
-		case protocol.ReceiverDirectCommunication:
-			close(relayCh)
-			tools.WriteEncryptedMessage(wsConn, protocol.TransferMessage{Type: protocol.SenderDirectAck}, s.crypt)
+	s.mu.Lock()
+	s.secret = broadcastPayload.Secret
+	s.mu.Unlock()
 
-			return nil
+	return nil
+}
 
-		// we will do relay communication with receiver using the same websocket connection as with tranx
-		case protocol.ReceiverRelayCommunication:
-			tools.WriteEncryptedMessage(wsConn, protocol.TransferMessage{Type: protocol.SenderRelayAck}, s.crypt)
-			relayCh <- wsConn
+// keyExchange holds the message types of the key exchange,
+// they differ between relaying it through tranx and answering the receiver directly.
+type keyExchange struct {
+	waitForReceiver bool
+	pakeOut         protocol.TranxMessageType
+	pakeIn          protocol.TranxMessageType
+	salt            protocol.TranxMessageType
+}
 
-			return nil
+var (
+	tranxKeyExchange = keyExchange{
+		waitForReceiver: true,
+		pakeOut:         protocol.SenderToTranxPAKE,
+		pakeIn:          protocol.TranxToSenderPAKE,
+		salt:            protocol.SenderToTranxSalt,
+	}
 
-		default:
-			return protocol.NewWrongMessageTypeError(
-				[]protocol.TransferMessageType{protocol.ReceiverDirectCommunication, protocol.ReceiverRelayCommunication},
-				transferMsg.Type)
+	// directKeyExchange speaks the part of tranx towards the receiver
+	directKeyExchange = keyExchange{
+		pakeOut: protocol.TranxToReceiverPAKE,
+		pakeIn:  protocol.ReceiverToTranxPAKE,
+		salt:    protocol.TranxToReceiverSalt,
 	}
-}
+)
 
 // establishSecureConnection setups the PAKE2 key exchange and the crypt struct in the sender.
-func (s *Sender) establishSecureConnection(wsConn *websocket.Conn, password models.Password) error {
+func (s *Sender) establishSecureConnection(wsConn *websocket.Conn, password models.Password, exchange keyExchange) error {
 	// init PAKE2 (NOTE: This takes a couple of seconds, here it is fine as we have to wait for the receiver)
 	pake, err := pake.InitCurve([]byte(password), 0, "p256")
 
@@ -110,21 +275,32 @@ func (s *Sender) establishSecureConnection(wsConn *websocket.Conn, password mode
 	}
 
 	// Wait for receiver to be ready to exchange crypto information.
-	msg, err := tools.ReadTranxMessage(wsConn, protocol.TranxToSenderReady)
-	if err != nil {
-		return err
+	if exchange.waitForReceiver {
+		s.setPhase(wsConn, protocol.PhaseRendezvous)
+		if _, err = tools.ReadTranxMessage(wsConn, protocol.TranxToSenderReady); err != nil {
+			return err
+		}
+
+		if s.joined != nil {
+			s.joined <- true
+		}
 	}
 
 	// PAKE sender -> receiver.
-	wsConn.WriteJSON(protocol.TranxMessage{
-		Type: protocol.SenderToTranxPAKE,
+	s.setPhase(wsConn, protocol.PhaseKeyExchange)
+	err = wsConn.WriteJSON(protocol.TranxMessage{
+		Type: exchange.pakeOut,
 		Payload: protocol.PakePayload{
 			Bytes: pake.Bytes(),
 		},
 	})
 
+	if err != nil {
+		return err
+	}
+
 	// PAKE receiver -> sender.
-	msg, err = tools.ReadTranxMessage(wsConn, protocol.TranxToSenderPAKE)
+	msg, err := tools.ReadTranxMessage(wsConn, exchange.pakeIn)
 	if err != nil {
 		return err
 	}
@@ -146,59 +322,159 @@ func (s *Sender) establishSecureConnection(wsConn *websocket.Conn, password mode
 		return err
 	}
 
-	s.crypt, err = crypt.New(sessionkey)
+	c, err := crypt.New(sessionkey)
 	if err != nil {
 		return err
 	}
 
 	// Send salt to receiver.
-	wsConn.WriteJSON(protocol.TranxMessage{
-		Type: protocol.SenderToTranxSalt,
+	err = wsConn.WriteJSON(protocol.TranxMessage{
+		Type: exchange.salt,
 		Payload: protocol.SaltPayload{
-			Salt: s.crypt.Salt,
+			Salt: c.Salt,
 		},
 	})
 
+	if err != nil {
+		return err
+	}
+
+	// from here on the receiver can be notified when the transfer is aborted
+	s.writeMu.Lock()
+	s.crypt = c
+	s.writeMu.Unlock()
+
 	return nil
 }
 
-// doHandshake does the transfer handshake over the tranx connection
-func (s *Sender) doHandshake(wsConn *websocket.Conn, payloadReady <-chan bool, startServerCh chan<- ServerOptions) error {
-	transferMsg, err := tools.ReadEncryptedMessage(wsConn, s.crypt)
-	if err != nil {
-		return err
+// compressFor prepares the payload again with gzip if the receiver does not decompress the compression of the payload,
+// like receivers of older versions, which only decompress gzip.
+func (s *Sender) compressFor(receiverHandshake protocol.ReceiverHandshakePayload) error {
+	if receiverHandshake.Decompresses(s.compression.Algorithm) {
+		return nil
 	}
 
-	if transferMsg.Type != protocol.ReceiverHandshake {
-		return protocol.NewWrongMessageTypeError([]protocol.TransferMessageType{protocol.ReceiverHandshake}, transferMsg.Type)
+	if s.selectFiles == nil {
+		return fmt.Errorf("the receiver does not decompress %s", s.compression.Algorithm)
+	}
+
+	compression := protocol.Compression{Algorithm: protocol.CompressionGzip}
+
+	payload, payloadSize, err := s.selectFiles(nil, compression)
+	if err != nil {
+		return fmt.Errorf("error compressing the files with gzip: %w", err)
 	}
 
-	handshakePayload := protocol.ReceiverHandshakePayload{}
-	err = tools.DecodePayload(transferMsg.Payload, &handshakePayload)
+	s.payload, s.payloadSize, s.compression = payload, payloadSize, compression
+
+	return nil
+}
+
+// doHandshake does the transfer handshake over the tranx connection,
+// the server for direct communication is only started if startServerCh is not nil.
+func (s *Sender) doHandshake(ctx context.Context, wsConn *websocket.Conn, payloadReady <-chan bool, startServerCh chan<- ServerOptions) error {
+	receiverHandshake, err := s.readReceiverHandshake(wsConn)
 	if err != nil {
 		return err
 	}
 
-	senderPort, err := tools.GetOpenPort()
+	return s.answerHandshake(ctx, wsConn, receiverHandshake, payloadReady, startServerCh)
+}
+
+// readReceiverHandshake reads the handshake of the receiver, the first message encrypted with the key of the exchange.
+func (s *Sender) readReceiverHandshake(wsConn *websocket.Conn) (protocol.ReceiverHandshakePayload, error) {
+	s.setPhase(wsConn, protocol.PhaseHandshake)
+	transferMsg, err := tools.ReadEncryptedMessage(wsConn, s.crypt)
 	if err != nil {
+		return protocol.ReceiverHandshakePayload{}, err
+	}
+
+	if transferMsg.Type != protocol.ReceiverHandshake {
+		return protocol.ReceiverHandshakePayload{}, protocol.NewWrongMessageTypeError([]protocol.TransferMessageType{protocol.ReceiverHandshake}, transferMsg.Type)
+	}
+
+	receiverHandshake := protocol.ReceiverHandshakePayload{}
+	err = tools.DecodePayload(transferMsg.Payload, &receiverHandshake)
+
+	return receiverHandshake, err
+}
+
+// answerHandshake answers the handshake of the receiver once the payload is ready,
+// the server for direct communication is only started if startServerCh is not nil.
+func (s *Sender) answerHandshake(ctx context.Context, wsConn *websocket.Conn, receiverHandshake protocol.ReceiverHandshakePayload,
+	payloadReady <-chan bool, startServerCh chan<- ServerOptions) error {
+	var err error
+
+	// without a server the receiver keeps using this connection
+	var listener net.Listener
+	var token string
+
+	if startServerCh != nil {
+		listener, err = tools.ListenDirect(s.direct)
+		if err != nil {
+			return err
+		}
+
+		// the receiver presents the token when connecting, only it learns the token over the encrypted connection
+		token, err = tools.GenerateToken()
+		if err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	// wait for payload to be ready, the receiver waits for as long as the prepare phase allows
+	select {
+		case <-payloadReady:
+
+		case <-ctx.Done():
+			if listener != nil {
+				listener.Close()
+			}
+
+			return ctx.Err()
+	}
+
+	if err := s.compressFor(receiverHandshake); err != nil {
+		if listener != nil {
+			listener.Close()
+		}
+
 		return err
 	}
 
-	// wait for payload to be ready
-	<-payloadReady
-	startServerCh <- ServerOptions{port: senderPort, receiverIP: handshakePayload.IP}
+	s.windowSize = windowFor(s.payloadSize)
 
-	tcpAddr, _ := wsConn.LocalAddr().(*net.TCPAddr)
-	handshake := protocol.TransferMessage{
-		Type: protocol.SenderHandshake,
-		Payload: protocol.SenderHandshakePayload{
-			IP:          tcpAddr.IP,
-			Port:        senderPort,
-			PayloadSize: s.payloadSize,
-		},
+	// the address of connections that are not TCP, like ones of a custom dialer, is unknown
+	var localIP net.IP
+	if tcpAddr, ok := wsConn.LocalAddr().(*net.TCPAddr); ok {
+		localIP = tcpAddr.IP
 	}
 
-	tools.WriteEncryptedMessage(wsConn, handshake, s.crypt)
+	handshakePayload := protocol.SenderHandshakePayload{
+		IP:          localIP,
+		PayloadSize: s.payloadSize,
+		Manifest:    s.manifest,
+		Window:      s.windowSize,
+		Compression: &s.compression,
+	}
 
-	return nil
+	// a port of zero tells the receiver to keep using this connection right away
+	if listener != nil {
+		startServerCh <- ServerOptions{listener: listener, token: token}
+
+		handshakePayload.Candidates = tools.ListenerCandidates(listener, localIP)
+		handshakePayload.Port = listener.Addr().(*net.TCPAddr).Port
+		handshakePayload.Streams = s.streamOffer()
+		handshakePayload.Token = token
+		handshakePayload.Reverse = true
+	}
+
+	s.setPhase(wsConn, protocol.PhaseHandshake)
+	handshake := protocol.TransferMessage{
+		Type:    protocol.SenderHandshake,
+		Payload: handshakePayload,
+	}
+
+	return s.writeMessage(wsConn, handshake)
 }
@@ -0,0 +1,175 @@
+package sender
+
+import (
+	"io"
+	"net"
+	"errors"
+	"context"
+	"strings"
+	"testing"
+	"net/http"
+	"sync/atomic"
+	"net/http/httptest"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models"
+	"github.com/abdfnx/tran/core/crypt"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+func TestCompressForOlderReceivers(t *testing.T) {
+	tests := []struct {
+		name         string
+		compressions []string
+		want         string
+	}{
+		{"older receiver", nil, protocol.CompressionGzip},
+		{"receiver of zstd", protocol.Compressions, protocol.CompressionZstd},
+		{"receiver of gzip only", []string{protocol.CompressionGzip}, protocol.CompressionGzip},
+	}
+
+	for _, test := range tests {
+		var prepared []protocol.Compression
+
+		s := WithCompression(NewSender(models.TranOptions{}), protocol.Compression{Algorithm: protocol.CompressionZstd, Level: 19})
+		s = WithSelection(s, func(only []string, compression protocol.Compression) (io.Reader, int64, error) {
+			prepared = append(prepared, compression)
+			return strings.NewReader("gzip"), 4, nil
+		})
+
+		if err := s.compressFor(protocol.ReceiverHandshakePayload{Compressions: test.compressions}); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if s.compression.Algorithm != test.want {
+			t.Errorf("%s: the payload is compressed with %s, want %s", test.name, s.compression.Algorithm, test.want)
+		}
+
+		// the payload is only prepared again for a receiver that does not decompress zstd
+		if again := test.want != protocol.CompressionZstd; again != (len(prepared) == 1) {
+			t.Errorf("%s: the payload was prepared again with %+v", test.name, prepared)
+		}
+
+		if len(prepared) == 1 && (prepared[0] != protocol.Compression{Algorithm: protocol.CompressionGzip} || s.payloadSize != 4) {
+			t.Errorf("%s: the payload was prepared with %+v, of size %d", test.name, prepared[0], s.payloadSize)
+		}
+	}
+
+	// without the files the payload can not be compressed again
+	s := WithCompression(NewSender(models.TranOptions{}), protocol.Compression{Algorithm: protocol.CompressionZstd})
+	if err := s.compressFor(protocol.ReceiverHandshakePayload{}); err == nil {
+		t.Error("a zstd payload was sent to a receiver that only decompresses gzip")
+	}
+}
+
+// pipeConn is a connection that is not TCP as far as its local address tells.
+type pipeConn struct {
+	net.Conn
+}
+
+func (pipeConn) LocalAddr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "unix"}
+}
+
+// dialThrough connects to a websocket server through the connection wrap returns and returns the connection of both sides.
+func dialThrough(t *testing.T, wrap func(net.Conn) net.Conn) (*websocket.Conn, *websocket.Conn) {
+	upgrader := websocket.Upgrader{}
+	peerCh := make(chan *websocket.Conn, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wsConn, err := upgrader.Upgrade(w, r, nil); err == nil {
+			peerCh <- wsConn
+		}
+	}))
+
+	t.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) {
+		conn, err := net.Dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return wrap(conn), nil
+	}}
+
+	wsConn, _, err := dialer.Dial("ws"+server.URL[len("http"):], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peer := <-peerCh
+	t.Cleanup(func() { wsConn.Close(); peer.Close() })
+
+	return wsConn, peer
+}
+
+func TestHandshakeOverConnectionsThatAreNotTCP(t *testing.T) {
+	wsConn, peer := dialThrough(t, func(conn net.Conn) net.Conn { return pipeConn{conn} })
+
+	c, err := crypt.New([]byte("the session key of the transfer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := WithPayload(NewSender(models.TranOptions{}), strings.NewReader("payload"), 7)
+	s.crypt = c
+
+	payloadReady := make(chan bool)
+	close(payloadReady)
+
+	startServerCh := make(chan ServerOptions, 1)
+	if err := s.answerHandshake(context.Background(), wsConn, protocol.ReceiverHandshakePayload{}, payloadReady, startServerCh); err != nil {
+		t.Fatal(err)
+	}
+
+	(<-startServerCh).listener.Close()
+
+	msg, err := tools.ReadEncryptedMessage(peer, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handshake := protocol.SenderHandshakePayload{}
+	if err := tools.DecodePayload(msg.Payload, &handshake); err != nil || handshake.IP != nil || handshake.Port == 0 {
+		t.Errorf("got the handshake %+v, %v, want one without the local address", handshake, err)
+	}
+}
+
+// brokenConn fails every write once broken is set.
+type brokenConn struct {
+	net.Conn
+	broken *int32
+}
+
+func (c brokenConn) Write(data []byte) (int, error) {
+	if atomic.LoadInt32(c.broken) != 0 {
+		return 0, errors.New("broken connection")
+	}
+
+	return c.Conn.Write(data)
+}
+
+func TestDirectAckThatFailsEndsTheNegotiation(t *testing.T) {
+	var broken int32
+	wsConn, peer := dialThrough(t, func(conn net.Conn) net.Conn { return brokenConn{conn, &broken} })
+
+	c, err := crypt.New([]byte("the session key of the transfer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSender(models.TranOptions{})
+	s.crypt = c
+
+	if err := tools.WriteEncryptedMessage(peer, protocol.TransferMessage{Type: protocol.ReceiverDirectCommunication}, c); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&broken, 1)
+
+	if transferConn, err := s.chooseTransport(context.Background(), wsConn, true); err == nil {
+		t.Errorf("got the connection %v, want the failed acknowledgement to end the negotiation", transferConn)
+	}
+}
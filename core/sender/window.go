@@ -0,0 +1,126 @@
+package sender
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"errors"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/constants"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// errAcksStopped is returned by a stream that can not send on because the receiver stopped acknowledging the payload.
+var errAcksStopped = errors.New("the receiver stopped acknowledging the payload")
+
+// window bounds the bytes of the payload that were sent but not acknowledged by the receiver yet.
+type window struct {
+	size    int64 // no bound if zero, as receivers of older versions do not acknowledge
+	total   int64
+	sent    int64
+	acked   int64
+	started time.Time
+	closed  bool
+	mu      sync.Mutex
+	cond    *sync.Cond
+}
+
+func newWindow(size, total int64) *window {
+	w := &window{size: size, total: total, started: time.Now()}
+	w.cond = sync.NewCond(&w.mu)
+
+	return w
+}
+
+// windowFor returns the window the sender offers in the handshake, large enough for a few chunks of the payload.
+func windowFor(payloadSize int64) int64 {
+	if size := 4 * ChunkSize(payloadSize); size > constants.TRANSFER_WINDOW_BYTES {
+		return size
+	}
+
+	return constants.TRANSFER_WINDOW_BYTES
+}
+
+// reserve waits until n more bytes fit into the window and counts them as sent, it reports false once the acknowledgements stopped.
+func (w *window) reserve(n int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.size > 0 && !w.closed && w.sent > w.acked && w.sent - w.acked + n > w.size {
+		w.cond.Wait()
+	}
+
+	if w.closed {
+		return false
+	}
+
+	w.sent += n
+
+	return true
+}
+
+// ack moves the window on to the bytes the receiver acknowledged, and returns the progress and the estimated time left.
+func (w *window) ack(bytes int64) (float32, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if bytes > w.acked && bytes <= w.sent {
+		w.acked = bytes
+		w.cond.Broadcast()
+	}
+
+	var eta time.Duration
+	if elapsed := time.Since(w.started); w.acked > 0 {
+		eta = time.Duration(float64(elapsed) * float64(w.total - w.acked) / float64(w.acked))
+	}
+
+	return float32(w.acked) / float32(w.total), eta
+}
+
+// close wakes the streams waiting for the window, nothing is acknowledged from then on.
+func (w *window) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+
+	w.cond.Broadcast()
+}
+
+// readAcks reads the messages of the receiver in the background while the payload is sent, like readNext.
+// The acknowledgements of the received bytes move the window on and report the progress, the first other message is returned.
+func (s *Sender) readAcks(wsConn *websocket.Conn, window *window) <-chan readResult {
+	next := make(chan readResult, 1)
+
+	go func() {
+		// the streams waiting for the window find the message on next
+		defer window.close()
+
+		for {
+			msg, err := tools.ReadEncryptedMessage(wsConn, s.crypt)
+			if err == nil && msg.Type == protocol.ReceiverPayloadProgress {
+				progress := protocol.ProgressPayload{}
+				if err = tools.DecodePayload(msg.Payload, &progress); err == nil {
+					s.updateProgress(window.ack(progress.Bytes))
+					continue
+				}
+			}
+
+			next <- readResult{msg: msg, err: err}
+
+			return
+		}
+	}()
+
+	return next
+}
+
+// receivedError returns the error the receiver aborted the transfer with, or the message it must not send while the payload is sent.
+func receivedError(received readResult) error {
+	if received.err != nil {
+		return received.err
+	}
+
+	return fmt.Errorf("unexpected message while streaming the payload: %s", received.msg.Type.Name())
+}
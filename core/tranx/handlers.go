@@ -1,9 +1,9 @@
 package tranx
 
 import (
-	"fmt"
-	"log"
 	"time"
+	"errors"
+	"net/http"
 	"encoding/json"
 
 	"github.com/gorilla/websocket"
@@ -12,6 +12,9 @@ import (
 	"github.com/abdfnx/tran/models/protocol"
 )
 
+// broadcastJoinTimeout bounds the wait of a receiver for the next connection of a broadcast sender.
+const broadcastJoinTimeout = 30 * time.Second
+
 // handleEstablishSender returns a websocket handler that communicates with the sender.
 func (s *Server) handleEstablishSender() tools.WsHandlerFunc {
 	return func(wsConn *websocket.Conn) {
@@ -28,11 +31,11 @@ func (s *Server) handleEstablishSender() tools.WsHandlerFunc {
 		err := wsConn.ReadJSON(&msg)
 
 		if err != nil {
-			log.Println("message did not follow protocol:", err)
+			s.logger.Println("message did not follow protocol:", err)
 			return
 		}
 
-		if !isExpected(msg.Type, protocol.SenderToTranxEstablish) {
+		if !s.isExpected(msg.Type, protocol.SenderToTranxEstablish) {
 			return
 		}
 
@@ -40,7 +43,7 @@ func (s *Server) handleEstablishSender() tools.WsHandlerFunc {
 		establishPayload := protocol.PasswordPayload{}
 		err = tools.DecodePayload(msg.Payload, &establishPayload)
 		if err != nil {
-			log.Println("error in SenderToTranxEstablish payload:", err)
+			s.logger.Println("error in SenderToTranxEstablish payload:", err)
 
 			return
 		}
@@ -50,178 +53,621 @@ func (s *Server) handleEstablishSender() tools.WsHandlerFunc {
 			Sender: &protocol.TranxSender{
 				TranxClient: *NewClient(wsConn),
 			},
+			Expires:              codeExpiry(establishPayload.Expires),
 			CommunicationChannel: make(chan []byte),
 			Quit:                 make(chan bool),
+			Left:                 make(chan struct{}),
+		}
+
+		// the receivers of a broadcast find the mailbox of the next sender connection through the stored one
+		receivers := establishPayload.Receivers
+		if receivers > constants.MAX_RECEIVERS {
+			receivers = constants.MAX_RECEIVERS
+		}
+
+		if receivers > 1 {
+			mailbox.Broadcast, err = NewBroadcast(receivers, mailbox.Expires)
+			if err != nil {
+				s.logger.Println("error creating the broadcast:", err)
+				s.ids.Delete(id)
+
+				return
+			}
+
+			s.mailboxes.StoreMailbox(establishPayload.Password, &Mailbox{Broadcast: mailbox.Broadcast})
+
+			// only the sender that announced the broadcast learns the secret its further connections present
+			wsConn.WriteJSON(protocol.TranxMessage{
+				Type: protocol.TranxToSenderBroadcast,
+				Payload: protocol.TranxToSenderBroadcastPayload{
+					Secret: mailbox.Broadcast.Secret(),
+				},
+			})
+		} else {
+			s.mailboxes.StoreMailbox(establishPayload.Password, mailbox)
 		}
 
-		s.mailboxes.StoreMailbox(establishPayload.Password, mailbox)
 		_, err = s.mailboxes.GetMailbox(establishPayload.Password)
 
 		if err != nil {
-			log.Println("The created mailbox could not be retrieved")
+			s.logger.Println("The created mailbox could not be retrieved")
 
 			return
 		}
 
 		// wait for receiver to connect
-		timeout := time.NewTimer(constants.RECEIVER_CONNECT_TIMEOUT)
+		read := readNext(wsConn)
+		joined, err := s.waitForPeer(mailbox, read)
+		s.ids.Delete(id)
 
-		select {
-			case <-timeout.C:
-				s.ids.Delete(id)
-				return
+		if err != nil {
+			s.abandon(establishPayload.Password, err)
 
-			case <-mailbox.CommunicationChannel:
-				// receiver connected
-				s.ids.Delete(id)
-				break
+			return
 		}
 
-		wsConn.WriteJSON(protocol.TranxMessage{
-			Type: protocol.TranxToSenderReady,
-		})
+		if !joined {
+			s.expire(wsConn, establishPayload.Password)
+
+			return
+		}
+
+		// receiver connected
+		if !s.exchangeSender(wsConn, mailbox, read) {
+			return
+		}
 
-		msg = protocol.TranxMessage{}
-		err = wsConn.ReadJSON(&msg)
+		// Start the relay of messages between the sender and receiver handlers.
+		startRelay(s, wsConn, mailbox, establishPayload.Password)
+	}
+}
+
+// handleEstablishReceiver returns a websocket handler that that communicates with the sender.
+func (s *Server) handleEstablishReceiver() tools.WsHandlerFunc {
+	return func(wsConn *websocket.Conn) {
+		// Establish receiver.
+		msg := protocol.TranxMessage{}
+		err := wsConn.ReadJSON(&msg)
 
 		if err != nil {
-			log.Println("message did not follow protocol:", err)
+			s.logger.Println("message did not follow protocol:", err)
+			return
+		}
 
+		if !s.isExpected(msg.Type, protocol.ReceiverToTranxEstablish) {
 			return
 		}
 
-		if !isExpected(msg.Type, protocol.SenderToTranxPAKE) {
+		establishPayload := protocol.PasswordPayload{}
+		err = tools.DecodePayload(msg.Payload, &establishPayload)
+		if err != nil {
+			s.logger.Println("error in ReceiverToTranxEstablish payload:", err)
 			return
 		}
 
-		pakePayload := protocol.PakePayload{}
-		err = tools.DecodePayload(msg.Payload, &pakePayload)
+		mailbox, err := s.mailboxes.GetMailbox(establishPayload.Password)
 
 		if err != nil {
-			log.Println("error in SenderToTranxPAKE payload:", err)
+			s.logger.Println("failed to get mailbox:", err)
+			s.rejectUnknown(wsConn, establishPayload.Password, "no sender is waiting with this password")
+
 			return
 		}
 
-		// send PAKE bytes to receiver
-		mailbox.CommunicationChannel <- pakePayload.Bytes
-		// respond with receiver PAKE bytes
-		wsConn.WriteJSON(protocol.TranxMessage{
-			Type: protocol.TranxToSenderPAKE,
-			Payload: protocol.PakePayload{
-				Bytes: <-mailbox.CommunicationChannel,
-			},
-		})
+		if mailbox.Request {
+			tools.WriteTranxError(wsConn, protocol.TranxErrorWrongDirection, "this password requests files, send them with `tran send --to`")
 
-		msg = protocol.TranxMessage{}
-		err = wsConn.ReadJSON(&msg)
+			return
+		}
 
-		if err != nil {
-			log.Println("message did not follow protocol:", err)
+		if mailbox.Broadcast != nil {
+			mailbox, err = s.joinBroadcast(wsConn, mailbox.Broadcast, establishPayload.Password)
+			if err != nil {
+				return
+			}
+		}
+
+		// reserve this mailbox for the receiver to receive, unless another one was first
+		if !mailbox.ReserveReceiver(NewClient(wsConn)) {
+			s.logger.Println("mailbox already has a receiver")
+			tools.WriteTranxError(wsConn, protocol.TranxErrorCodeInUse, "another receiver is already using this password")
 
 			return
 		}
 
-		if !isExpected(msg.Type, protocol.SenderToTranxSalt) {
-			return
+		if mailbox.Broadcast == nil {
+			s.mailboxes.StoreMailbox(establishPayload.Password, mailbox)
 		}
 
-		saltPayload := protocol.SaltPayload{}
-		err = tools.DecodePayload(msg.Payload, &saltPayload)
+		// notify sender we are connected, unless it left meanwhile
+		select {
+			case mailbox.CommunicationChannel <- nil:
 
-		if err != nil {
-			log.Println("error in SenderToTranxSalt payload:", err)
+			case <-mailbox.Left:
+				tools.WriteTranxError(wsConn, protocol.TranxErrorUnknownCode, "no sender is waiting with this password")
+
+				return
+		}
+
+		if !s.exchangeReceiver(wsConn, mailbox, readNext(wsConn)) {
 			return
 		}
 
-		// Send the salt to the receiver.
-		mailbox.CommunicationChannel <- saltPayload.Salt
-		// Start the relay of messages between the sender and receiver handlers.
+		// the password works only once, a broadcast retires it once the last receiver joined
+		if mailbox.Broadcast == nil {
+			s.retire(establishPayload.Password, protocol.TranxErrorCodeUsed)
+		}
+
 		startRelay(s, wsConn, mailbox, establishPayload.Password)
 	}
 }
 
-// handleEstablishReceiver returns a websocket handler that that communicates with the sender.
-func (s *Server) handleEstablishReceiver() tools.WsHandlerFunc {
+// waitForPeer waits for the peer of the client that allocated a mailbox to join it until the password expires
+// and reports whether one did, a sender connection of a broadcast first waits for a receiver to take its mailbox.
+// It returns the error of the connection if the client closes it meanwhile. Unless the peer joined, the mailbox is left.
+func (s *Server) waitForPeer(mailbox *Mailbox, read *pendingRead) (joined bool, err error) {
+	timeout := time.NewTimer(time.Until(mailbox.Expires))
+	defer timeout.Stop()
+
+	defer func() {
+		if !joined {
+			close(mailbox.Left)
+		}
+	}()
+
+	if mailbox.Broadcast != nil {
+		select {
+			case <-timeout.C:
+				return false, nil
+
+			case <-read.failed():
+				return false, read.err
+
+			case mailbox.Broadcast.Join <- mailbox:
+		}
+	}
+
+	select {
+		case <-timeout.C:
+			return false, nil
+
+		case <-read.failed():
+			return false, read.err
+
+		case <-mailbox.CommunicationChannel:
+			return true, nil
+	}
+}
+
+// pendingRead reads the next message of a client in the background while the client waits for its peer,
+// so that the wait ends once the client closes its connection instead of lasting until the password expires.
+type pendingRead struct {
+	msg  protocol.TranxMessage
+	err  error
+	done chan struct{}
+	fail chan struct{}
+}
+
+// readNext starts to read the next message of wsConn, nothing else may read from wsConn until it is taken with next.
+func readNext(wsConn *websocket.Conn) *pendingRead {
+	read := &pendingRead{
+		done: make(chan struct{}),
+		fail: make(chan struct{}),
+	}
+
+	go func() {
+		read.err = wsConn.ReadJSON(&read.msg)
+		if read.err != nil {
+			close(read.fail)
+		}
+
+		close(read.done)
+	}()
+
+	return read
+}
+
+// failed returns a channel that is closed if the connection fails before the next message arrives.
+func (read *pendingRead) failed() <-chan struct{} {
+	return read.fail
+}
+
+// next waits for the next message of the client and returns it.
+func (read *pendingRead) next() (protocol.TranxMessage, error) {
+	<-read.done
+
+	return read.msg, read.err
+}
+
+// joinBroadcast returns the mailbox of the sender connection waiting for the receiver of wsConn,
+// the broadcast is deallocated once the last receiver has joined. The receiver is told why it can not join.
+func (s *Server) joinBroadcast(wsConn *websocket.Conn, broadcast *Broadcast, password string) (*Mailbox, error) {
+	mailbox, last, err := broadcast.Take(broadcastJoinTimeout)
+
+	switch {
+		case errors.Is(err, ErrBroadcastFull):
+			tools.WriteTranxError(wsConn, protocol.TranxErrorCodeInUse, "every receiver the sender sends to has joined already")
+
+		case err != nil:
+			tools.WriteTranxError(wsConn, protocol.TranxErrorUnknownCode, "no sender is waiting with this password")
+
+		case last:
+			s.retire(password, protocol.TranxErrorCodeUsed)
+	}
+
+	return mailbox, err
+}
+
+// handleEstablishBroadcastSender returns a websocket handler that communicates with a sender
+// that connects once more to send its payload to the next receiver of a broadcast.
+func (s *Server) handleEstablishBroadcastSender() tools.WsHandlerFunc {
 	return func(wsConn *websocket.Conn) {
-		// Establish receiver.
 		msg := protocol.TranxMessage{}
 		err := wsConn.ReadJSON(&msg)
 
 		if err != nil {
-			log.Println("message did not follow protocol:", err)
+			s.logger.Println("message did not follow protocol:", err)
 			return
 		}
 
-		if !isExpected(msg.Type, protocol.ReceiverToTranxEstablish) {
+		if !s.isExpected(msg.Type, protocol.SenderToTranxEstablish) {
 			return
 		}
 
 		establishPayload := protocol.PasswordPayload{}
 		err = tools.DecodePayload(msg.Payload, &establishPayload)
 		if err != nil {
-			log.Println("error in ReceiverToTranxEstablish payload:", err)
+			s.logger.Println("error in SenderToTranxEstablish payload:", err)
 			return
 		}
 
-		mailbox, err := s.mailboxes.GetMailbox(establishPayload.Password)
+		broadcast, err := s.mailboxes.GetMailbox(establishPayload.Password)
+
+		// only the sender that announced the broadcast knows its secret
+		if err != nil || broadcast.Broadcast == nil || !broadcast.Broadcast.Admits(establishPayload.Secret) {
+			s.rejectUnknown(wsConn, establishPayload.Password, "no broadcast is running with this password")
+
+			return
+		}
+
+		mailbox := &Mailbox{
+			Sender: &protocol.TranxSender{
+				TranxClient: *NewClient(wsConn),
+			},
+			Broadcast:            broadcast.Broadcast,
+			Expires:              broadcast.Broadcast.Expires,
+			CommunicationChannel: make(chan []byte),
+			Quit:                 make(chan bool),
+			Left:                 make(chan struct{}),
+		}
+
+		read := readNext(wsConn)
+		joined, err := s.waitForPeer(mailbox, read)
 
 		if err != nil {
-			log.Println("failed to get mailbox:", err)
+			s.abandon(establishPayload.Password, err)
+
 			return
 		}
 
-		if mailbox.Receiver != nil {
-			log.Println("mailbox already has a receiver:", err)
+		if !joined {
+			s.expire(wsConn, establishPayload.Password)
+
 			return
 		}
 
-		// this receiver was first, reserve this mailbox for it to receive
-		mailbox.Receiver = NewClient(wsConn)
-		s.mailboxes.StoreMailbox(establishPayload.Password, mailbox)
+		if !s.exchangeSender(wsConn, mailbox, read) {
+			return
+		}
+
+		startRelay(s, wsConn, mailbox, establishPayload.Password)
+	}
+}
+
+// codeExpiry returns when a password established now expires, after the seconds the client asked for
+// or after RECEIVER_CONNECT_TIMEOUT, at the latest after MAX_CODE_EXPIRY.
+func codeExpiry(seconds int) time.Time {
+	expiry := constants.RECEIVER_CONNECT_TIMEOUT
+	if seconds > 0 {
+		expiry = time.Duration(seconds) * time.Second
+	}
+
+	if expiry > constants.MAX_CODE_EXPIRY {
+		expiry = constants.MAX_CODE_EXPIRY
+	}
+
+	return time.Now().Add(expiry)
+}
+
+// retire deallocates the mailbox of a password that can no longer be used and remembers why.
+func (s *Server) retire(password string, reason protocol.TranxErrorCode) {
+	s.mailboxes.DeleteMailbox(password)
+	s.retired.Retire(password, reason)
+}
 
-		// notify sender we are connected
-		mailbox.CommunicationChannel <- nil
-		// send back received sender PAKE bytes
+// expire retires a password that no peer used in time and tells the client of wsConn, which waited for the peer.
+func (s *Server) expire(wsConn *websocket.Conn, password string) {
+	s.retire(password, protocol.TranxErrorCodeExpired)
+	tools.WriteTranxError(wsConn, protocol.TranxErrorCodeExpired, "the password expired before anyone used it")
+}
+
+// abandon deallocates the mailbox of a password whose client closed its connection while it waited for its peer,
+// the mailbox of a broadcast is deallocated as well, as the sender of the broadcast is gone.
+func (s *Server) abandon(password string, err error) {
+	s.logger.Println("the client left before its peer joined:", err)
+	s.mailboxes.DeleteMailbox(password)
+}
+
+// rejectUnknown tells a client that no mailbox is allocated for password, or why the password can no longer be used.
+func (s *Server) rejectUnknown(wsConn *websocket.Conn, password string, message string) {
+	reason, retired := s.retired.Reason(password)
+
+	switch {
+		case retired && reason == protocol.TranxErrorCodeUsed:
+			tools.WriteTranxError(wsConn, reason, "this password was used already, passwords work only once")
+
+		case retired && reason == protocol.TranxErrorCodeExpired:
+			tools.WriteTranxError(wsConn, reason, "this password has expired, ask for a new one")
+
+		default:
+			tools.WriteTranxError(wsConn, protocol.TranxErrorUnknownCode, message)
+	}
+}
+
+// exchangeSender announces the receiver to the sender and forwards the key exchange of the sender to the receiver,
+// whose first message is read by read. It reports whether the sender followed the protocol.
+func (s *Server) exchangeSender(wsConn *websocket.Conn, mailbox *Mailbox, read *pendingRead) bool {
+	wsConn.WriteJSON(protocol.TranxMessage{
+		Type: protocol.TranxToSenderReady,
+	})
+
+	msg, err := read.next()
+
+	if err != nil {
+		s.logger.Println("message did not follow protocol:", err)
+
+		return false
+	}
+
+	if !s.isExpected(msg.Type, protocol.SenderToTranxPAKE) {
+		return false
+	}
+
+	pakePayload := protocol.PakePayload{}
+	err = tools.DecodePayload(msg.Payload, &pakePayload)
+
+	if err != nil {
+		s.logger.Println("error in SenderToTranxPAKE payload:", err)
+		return false
+	}
+
+	// send PAKE bytes to receiver
+	mailbox.CommunicationChannel <- pakePayload.Bytes
+	// respond with receiver PAKE bytes
+	wsConn.WriteJSON(protocol.TranxMessage{
+		Type: protocol.TranxToSenderPAKE,
+		Payload: protocol.PakePayload{
+			Bytes: <-mailbox.CommunicationChannel,
+		},
+	})
+
+	msg = protocol.TranxMessage{}
+	err = wsConn.ReadJSON(&msg)
+
+	if err != nil {
+		s.logger.Println("message did not follow protocol:", err)
+
+		return false
+	}
+
+	if !s.isExpected(msg.Type, protocol.SenderToTranxSalt) {
+		return false
+	}
+
+	saltPayload := protocol.SaltPayload{}
+	err = tools.DecodePayload(msg.Payload, &saltPayload)
+
+	if err != nil {
+		s.logger.Println("error in SenderToTranxSalt payload:", err)
+		return false
+	}
+
+	// Send the salt to the receiver.
+	mailbox.CommunicationChannel <- saltPayload.Salt
+
+	return true
+}
+
+// exchangeReceiver forwards the key exchange of the receiver to the sender, once the sender is connected,
+// the first message of the receiver is read by read. It reports whether the receiver followed the protocol.
+func (s *Server) exchangeReceiver(wsConn *websocket.Conn, mailbox *Mailbox, read *pendingRead) bool {
+	// send back received sender PAKE bytes
+	wsConn.WriteJSON(protocol.TranxMessage{
+		Type: protocol.TranxToReceiverPAKE,
+		Payload: protocol.PakePayload{
+			Bytes: <-mailbox.CommunicationChannel,
+		},
+	})
+
+	msg, err := read.next()
+
+	if err != nil {
+		s.logger.Println("message did not follow protocol:", err)
+		return false
+	}
+
+	if !s.isExpected(msg.Type, protocol.ReceiverToTranxPAKE) {
+		return false
+	}
+
+	receiverPakePayload := protocol.PakePayload{}
+	err = tools.DecodePayload(msg.Payload, &receiverPakePayload)
+
+	if err != nil {
+		s.logger.Println("error in ReceiverToTranxPAKE payload:", err)
+		return false
+	}
+
+	mailbox.CommunicationChannel <- receiverPakePayload.Bytes
+	wsConn.WriteJSON(protocol.TranxMessage{
+		Type: protocol.TranxToReceiverSalt,
+		Payload: protocol.SaltPayload{
+			Salt: <-mailbox.CommunicationChannel,
+		},
+	})
+
+	return true
+}
+
+// handleEstablishRequester returns a websocket handler that communicates with a receiver that requests a payload,
+// it waits for the sender like handleEstablishSender waits for the receiver.
+func (s *Server) handleEstablishRequester() tools.WsHandlerFunc {
+	return func(wsConn *websocket.Conn) {
+		// Bind an ID to this communication and send it to the receiver
+		id := s.ids.Bind()
 		wsConn.WriteJSON(protocol.TranxMessage{
-			Type: protocol.TranxToReceiverPAKE,
-			Payload: protocol.PakePayload{
-				Bytes: <-mailbox.CommunicationChannel,
+			Type: protocol.TranxToSenderBind,
+			Payload: protocol.TranxToSenderBindPayload{
+				ID: id,
 			},
 		})
 
-		msg = protocol.TranxMessage{}
-		err = wsConn.ReadJSON(&msg)
+		msg := protocol.TranxMessage{}
+		err := wsConn.ReadJSON(&msg)
 
 		if err != nil {
-			log.Println("message did not follow protocol:", err)
+			s.logger.Println("message did not follow protocol:", err)
+			s.ids.Delete(id)
+
 			return
 		}
 
-		if !isExpected(msg.Type, protocol.ReceiverToTranxPAKE) {
+		if !s.isExpected(msg.Type, protocol.ReceiverToTranxEstablish) {
+			s.ids.Delete(id)
 			return
 		}
 
-		receiverPakePayload := protocol.PakePayload{}
-		err = tools.DecodePayload(msg.Payload, &receiverPakePayload)
+		establishPayload := protocol.PasswordPayload{}
+		err = tools.DecodePayload(msg.Payload, &establishPayload)
+		if err != nil {
+			s.logger.Println("error in ReceiverToTranxEstablish payload:", err)
+			s.ids.Delete(id)
+
+			return
+		}
+
+		// Allocate a mailbox the sender joins, it is only shared once it is stored.
+		mailbox := &Mailbox{
+			Receiver:             NewClient(wsConn),
+			Request:              true,
+			Expires:              codeExpiry(establishPayload.Expires),
+			CommunicationChannel: make(chan []byte),
+			Quit:                 make(chan bool),
+			Left:                 make(chan struct{}),
+		}
+
+		s.mailboxes.StoreMailbox(establishPayload.Password, mailbox)
+
+		// wait for sender to connect
+		read := readNext(wsConn)
+		joined, err := s.waitForPeer(mailbox, read)
+		s.ids.Delete(id)
 
 		if err != nil {
-			log.Println("error in ReceiverToTranxPAKE payload:", err)
+			s.abandon(establishPayload.Password, err)
+
+			return
+		}
+
+		if !joined {
+			s.expire(wsConn, establishPayload.Password)
+
 			return
 		}
 
-		mailbox.CommunicationChannel <- receiverPakePayload.Bytes
+		// sender connected
 		wsConn.WriteJSON(protocol.TranxMessage{
-			Type: protocol.TranxToReceiverSalt,
-			Payload: protocol.SaltPayload{
-				Salt: <-mailbox.CommunicationChannel,
-			},
+			Type: protocol.TranxToReceiverReady,
 		})
 
+		if !s.exchangeReceiver(wsConn, mailbox, read) {
+			return
+		}
+
+		startRelay(s, wsConn, mailbox, establishPayload.Password)
+	}
+}
+
+// handleEstablishRequestedSender returns a websocket handler that communicates with a sender
+// that sends its payload to the receiver that requested it.
+func (s *Server) handleEstablishRequestedSender() tools.WsHandlerFunc {
+	return func(wsConn *websocket.Conn) {
+		msg := protocol.TranxMessage{}
+		err := wsConn.ReadJSON(&msg)
+
+		if err != nil {
+			s.logger.Println("message did not follow protocol:", err)
+			return
+		}
+
+		if !s.isExpected(msg.Type, protocol.SenderToTranxEstablish) {
+			return
+		}
+
+		establishPayload := protocol.PasswordPayload{}
+		err = tools.DecodePayload(msg.Payload, &establishPayload)
+		if err != nil {
+			s.logger.Println("error in SenderToTranxEstablish payload:", err)
+			return
+		}
+
+		mailbox, err := s.mailboxes.GetMailbox(establishPayload.Password)
+
+		if err != nil {
+			s.logger.Println("failed to get mailbox:", err)
+			s.rejectUnknown(wsConn, establishPayload.Password, "no receiver requests files with this password")
+
+			return
+		}
+
+		if !mailbox.Request {
+			tools.WriteTranxError(wsConn, protocol.TranxErrorWrongDirection, "this password sends files, receive them with `tran receive`")
+
+			return
+		}
+
+		// reserve this mailbox for the sender to send, unless another one was first
+		if !mailbox.ReserveSender(&protocol.TranxSender{TranxClient: *NewClient(wsConn)}) {
+			s.logger.Println("mailbox already has a sender")
+			tools.WriteTranxError(wsConn, protocol.TranxErrorCodeInUse, "another sender is already using this password")
+
+			return
+		}
+
+		// notify receiver we are connected, unless it left meanwhile
+		select {
+			case mailbox.CommunicationChannel <- nil:
+
+			case <-mailbox.Left:
+				tools.WriteTranxError(wsConn, protocol.TranxErrorUnknownCode, "no receiver requests files with this password")
+
+				return
+		}
+
+		if !s.exchangeSender(wsConn, mailbox, readNext(wsConn)) {
+			return
+		}
+
+		// the password works only once
+		s.retire(establishPayload.Password, protocol.TranxErrorCodeUsed)
+
 		startRelay(s, wsConn, mailbox, establishPayload.Password)
 	}
 }
 
 // starts the relay service, closing it on request (if i.e. clients can communicate directly)
+// Each direction holds a message read from its client and one waiting to be handed over at most,
+// a client that sends faster than the other one takes its messages is not read from meanwhile.
 func startRelay(s *Server, wsConn *websocket.Conn, mailbox *Mailbox, mailboxPassword string) {
 	relayForwardCh := make(chan []byte)
 	// listen for incoming websocket messages from currently handled client
@@ -230,8 +676,8 @@ func startRelay(s *Server, wsConn *websocket.Conn, mailbox *Mailbox, mailboxPass
 			_, p, err := wsConn.ReadMessage()
 
 			if err != nil {
-				log.Println("error when listening to incoming client messages:", err)
-				fmt.Printf("closed by: %s\n", wsConn.RemoteAddr())
+				s.logger.Println("error when listening to incoming client messages:", err)
+				s.logger.Printf("closed by: %s\n", wsConn.RemoteAddr())
 				mailbox.Quit <- true
 
 				return
@@ -252,32 +698,66 @@ func startRelay(s *Server, wsConn *websocket.Conn, mailbox *Mailbox, mailboxPass
 				err := json.Unmarshal(relayForwardPayload, &msg)
 				// failed to unmarshal, we are in (encrypted) relay-mode, forward message directly to client
 				if err != nil {
-					mailbox.CommunicationChannel <- relayForwardPayload
+					if !relayForward(s, wsConn, mailbox, mailboxPassword, relayForwardPayload) {
+						return
+					}
 				} else {
 					// close the relay service if sender requested it
-					if isExpected(msg.Type, protocol.ReceiverToTranxClose) {
+					if s.isExpected(msg.Type, protocol.ReceiverToTranxClose) {
 						mailbox.Quit <- true
 
 						return
 					}
 				}
 
-			// deallocate mailbox and quit
+			// deallocate mailbox and quit, the mailbox of a broadcast stays for the other receivers
 			case <-mailbox.Quit:
-				s.mailboxes.Delete(mailboxPassword)
+				if mailbox.Broadcast == nil {
+					s.mailboxes.Delete(mailboxPassword)
+				}
 
 				return
 		}
 	}
 }
 
+// relayForward hands a message over to the other client, and relays the messages of the other client meanwhile,
+// as both clients share the channel and send at the same time while the payload is acknowledged.
+// It reports false if the relay service quit.
+func relayForward(s *Server, wsConn *websocket.Conn, mailbox *Mailbox, mailboxPassword string, payload []byte) bool {
+	for {
+		select {
+			case mailbox.CommunicationChannel <- payload:
+				return true
+
+			case relayReceivePayload := <-mailbox.CommunicationChannel:
+				wsConn.WriteMessage(websocket.BinaryMessage, relayReceivePayload)
+
+			case <-mailbox.Quit:
+				if mailbox.Broadcast == nil {
+					s.mailboxes.Delete(mailboxPassword)
+				}
+
+				return false
+		}
+	}
+}
+
 // isExpected is a convenience helper function that checks message types and logs errors.
-func isExpected(actual protocol.TranxMessageType, expected protocol.TranxMessageType) bool {
+func (s *Server) isExpected(actual protocol.TranxMessageType, expected protocol.TranxMessageType) bool {
 	wasExpected := actual == expected
 
 	if !wasExpected {
-		log.Printf("Expected message of type: %d. Got type %d\n", expected, actual)
+		s.logger.Printf("Expected message of type: %d. Got type %d\n", expected, actual)
 	}
 
 	return wasExpected
 }
+
+// handleHealth returns a handler that answers clients choosing between tranx servers by latency.
+func (s *Server) handleHealth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+}
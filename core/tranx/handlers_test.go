@@ -0,0 +1,179 @@
+package tranx
+
+import (
+	"io"
+	"log"
+	"net"
+	"time"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// startServer serves a tranx server on a free port of the loopback interface.
+func startServer(t *testing.T) (*Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := WithLogger(NewServer(0), log.New(io.Discard, "", 0))
+	go s.Serve(listener)
+	t.Cleanup(func() { listener.Close() })
+
+	return s, listener.Addr().String()
+}
+
+// dial connects to path of the tranx server at address.
+func dial(t *testing.T, address string, path string) *websocket.Conn {
+	wsConn, _, err := websocket.DefaultDialer.Dial("ws://"+address+"/"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { wsConn.Close() })
+
+	return wsConn
+}
+
+// establish sends the SenderToTranxEstablish or ReceiverToTranxEstablish message with payload.
+func establish(t *testing.T, wsConn *websocket.Conn, msgType protocol.TranxMessageType, payload protocol.PasswordPayload) {
+	if err := wsConn.WriteJSON(protocol.TranxMessage{Type: msgType, Payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// announceBroadcast establishes a sender that broadcasts to two receivers with password and returns its connection and secret.
+func announceBroadcast(t *testing.T, address string, password string) (*websocket.Conn, string) {
+	wsConn := dial(t, address, "establish-sender")
+	if _, err := tools.ReadTranxMessage(wsConn, protocol.TranxToSenderBind); err != nil {
+		t.Fatal(err)
+	}
+
+	establish(t, wsConn, protocol.SenderToTranxEstablish, protocol.PasswordPayload{Password: password, Receivers: 2})
+
+	msg, err := tools.ReadTranxMessage(wsConn, protocol.TranxToSenderBroadcast)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broadcastPayload := protocol.TranxToSenderBroadcastPayload{}
+	if err := tools.DecodePayload(msg.Payload, &broadcastPayload); err != nil || broadcastPayload.Secret == "" {
+		t.Fatalf("got the secret %q, %v", broadcastPayload.Secret, err)
+	}
+
+	return wsConn, broadcastPayload.Secret
+}
+
+// expectRejected checks that tranx rejects the client of wsConn with code.
+func expectRejected(t *testing.T, wsConn *websocket.Conn, code protocol.TranxErrorCode) {
+	wsConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	msg, err := tools.ReadTranxMessage(wsConn, protocol.TranxToClientError)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errorPayload := protocol.TranxErrorPayload{}
+	if err := tools.DecodePayload(msg.Payload, &errorPayload); err != nil || errorPayload.Code != code {
+		t.Errorf("got the code %d, %v, want tranx to reject the client with code %d", errorPayload.Code, err, code)
+	}
+}
+
+func TestBroadcastSenderPresentsTheSecret(t *testing.T) {
+	_, address := startServer(t)
+	_, secret := announceBroadcast(t, address, "broadcast")
+
+	for _, presented := range []string{"", "0123456789abcdef"} {
+		wsConn := dial(t, address, "establish-broadcast-sender")
+		establish(t, wsConn, protocol.SenderToTranxEstablish, protocol.PasswordPayload{Password: "broadcast", Secret: presented})
+		expectRejected(t, wsConn, protocol.TranxErrorUnknownCode)
+	}
+
+	// the connection with the secret waits for a receiver
+	wsConn := dial(t, address, "establish-broadcast-sender")
+	establish(t, wsConn, protocol.SenderToTranxEstablish, protocol.PasswordPayload{Password: "broadcast", Secret: secret})
+	wsConn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+
+	if _, err := tools.ReadTranxMessage(wsConn, protocol.TranxToSenderReady); !isTimeout(err) {
+		t.Errorf("got %v, want the sender to wait for a receiver", err)
+	}
+}
+
+// waitForAllocation waits until a mailbox is allocated for password.
+func waitForAllocation(t *testing.T, s *Server, password string) {
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := s.mailboxes.GetMailbox(password); err == nil {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("no mailbox is allocated for %s", password)
+		}
+	}
+}
+
+// waitForDeallocation waits until the mailbox of password is deallocated.
+func waitForDeallocation(t *testing.T, s *Server, password string) {
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := s.mailboxes.GetMailbox(password); err != nil {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("the mailbox of %s is still allocated after its client left", password)
+		}
+	}
+}
+
+func TestBroadcastIsDroppedOnceItsSenderLeaves(t *testing.T) {
+	s, address := startServer(t)
+	wsConn, _ := announceBroadcast(t, address, "broadcast")
+	wsConn.Close()
+	waitForDeallocation(t, s, "broadcast")
+
+	receiverConn := dial(t, address, "establish-receiver")
+	establish(t, receiverConn, protocol.ReceiverToTranxEstablish, protocol.PasswordPayload{Password: "broadcast"})
+	expectRejected(t, receiverConn, protocol.TranxErrorUnknownCode)
+}
+
+func TestWaitEndsOnceTheClientLeaves(t *testing.T) {
+	tests := []struct {
+		path     string
+		msgType  protocol.TranxMessageType
+		peerPath string
+		peerType protocol.TranxMessageType
+	}{
+		{"establish-sender", protocol.SenderToTranxEstablish, "establish-receiver", protocol.ReceiverToTranxEstablish},
+		{"establish-requester", protocol.ReceiverToTranxEstablish, "establish-requested-sender", protocol.SenderToTranxEstablish},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			s, address := startServer(t)
+
+			// the password expires long after the test
+			wsConn := dial(t, address, test.path)
+			if _, err := tools.ReadTranxMessage(wsConn, protocol.TranxToSenderBind); err != nil {
+				t.Fatal(err)
+			}
+
+			establish(t, wsConn, test.msgType, protocol.PasswordPayload{Password: "waiting", Expires: 3600})
+			waitForAllocation(t, s, "waiting")
+			wsConn.Close()
+			waitForDeallocation(t, s, "waiting")
+
+			peerConn := dial(t, address, test.peerPath)
+			establish(t, peerConn, test.peerType, protocol.PasswordPayload{Password: "waiting"})
+			expectRejected(t, peerConn, protocol.TranxErrorUnknownCode)
+		})
+	}
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+
+	return ok && netErr.Timeout()
+}
@@ -4,17 +4,126 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"time"
+	"errors"
+	"crypto/rand"
+	"encoding/hex"
+	"crypto/subtle"
 
 	"github.com/gorilla/websocket"
 	"github.com/abdfnx/tran/models/protocol"
 )
 
 // Mailbox is a data structure that links together a sender and a receiver client.
+// It is created by the sender, unless the receiver requested the payload and waits for the sender.
+// Once it is stored, the client that joins it is set with ReserveSender or ReserveReceiver.
 type Mailbox struct {
 	Sender               *protocol.TranxSender
 	Receiver             *protocol.TranxReceiver
+	Request              bool
+	Broadcast            *Broadcast
+	Expires              time.Time
 	CommunicationChannel chan []byte
 	Quit                 chan bool
+	Left                 chan struct{} // closed once the client that allocated the mailbox stops waiting for its peer
+	mu                   sync.Mutex
+}
+
+// ReserveSender makes sender the sender of the mailbox and reports whether no other sender was first.
+func (m *Mailbox) ReserveSender(sender *protocol.TranxSender) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Sender != nil {
+		return false
+	}
+
+	m.Sender = sender
+
+	return true
+}
+
+// ReserveReceiver makes receiver the receiver of the mailbox and reports whether no other receiver was first.
+func (m *Mailbox) ReserveReceiver(receiver *protocol.TranxReceiver) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Receiver != nil {
+		return false
+	}
+
+	m.Receiver = receiver
+
+	return true
+}
+
+// ErrBroadcastFull is returned when every receiver a broadcast is meant for has joined it.
+var ErrBroadcastFull = errors.New("every receiver has joined the broadcast")
+
+// ErrNoSenderWaiting is returned when no connection of a broadcast sender waits for the next receiver.
+var ErrNoSenderWaiting = errors.New("no sender is waiting for the next receiver")
+
+// Broadcast links the mailboxes of a sender that sends its payload to several receivers, one mailbox per receiver.
+// The mailbox stored for the password only holds the Broadcast, the sender connects once more for every receiver
+// and hands the mailbox of that connection to the next receiver that joins. Only the connections that present
+// the secret tranx told the sender that announced the broadcast may join it as sender.
+type Broadcast struct {
+	Join      chan *Mailbox
+	Expires   time.Time
+	secret    string
+	remaining int
+	mu        sync.Mutex
+}
+
+// NewBroadcast returns a broadcast to the supplied number of receivers, whose password expires at expires.
+func NewBroadcast(receivers int, expires time.Time) (*Broadcast, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return &Broadcast{
+		Join:      make(chan *Mailbox),
+		Expires:   expires,
+		secret:    hex.EncodeToString(secret),
+		remaining: receivers,
+	}, nil
+}
+
+// Secret returns the secret the further connections of the sender present to join the broadcast.
+func (b *Broadcast) Secret() string {
+	return b.secret
+}
+
+// Admits reports whether a sender connection that presents secret may join the broadcast.
+func (b *Broadcast) Admits(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(b.secret)) == 1
+}
+
+// Take reserves a place in the broadcast and returns the mailbox of the sender connection
+// that waits for the receiver, if one does so within timeout. It also reports whether this was the last place.
+func (b *Broadcast) Take(timeout time.Duration) (*Mailbox, bool, error) {
+	b.mu.Lock()
+	if b.remaining == 0 {
+		b.mu.Unlock()
+		return nil, false, ErrBroadcastFull
+	}
+
+	b.remaining--
+	last := b.remaining == 0
+	b.mu.Unlock()
+
+	select {
+		case mailbox := <-b.Join:
+			return mailbox, last, nil
+
+		case <-time.After(timeout):
+			b.mu.Lock()
+			b.remaining++
+			b.mu.Unlock()
+
+			return nil, false, ErrNoSenderWaiting
+	}
 }
 
 type Mailboxes struct{ *sync.Map }
@@ -0,0 +1,57 @@
+package tranx
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// reserveConcurrently reserves the mailbox with reserve from several goroutines at once and returns how many succeeded.
+func reserveConcurrently(reserve func() bool) int {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if reserve() {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return reserved
+}
+
+func TestReserveReceiver(t *testing.T) {
+	mailbox := &Mailbox{}
+
+	reserved := reserveConcurrently(func() bool {
+		return mailbox.ReserveReceiver(&protocol.TranxReceiver{})
+	})
+
+	if reserved != 1 || mailbox.Receiver == nil {
+		t.Errorf("%d receivers reserved the mailbox, want 1", reserved)
+	}
+}
+
+func TestReserveSender(t *testing.T) {
+	mailbox := &Mailbox{Request: true}
+
+	reserved := reserveConcurrently(func() bool {
+		return mailbox.ReserveSender(&protocol.TranxSender{})
+	})
+
+	if reserved != 1 || mailbox.Sender == nil {
+		t.Errorf("%d senders reserved the mailbox, want 1", reserved)
+	}
+}
@@ -0,0 +1,62 @@
+package tranx
+
+import (
+	"sync"
+	"time"
+
+	"github.com/abdfnx/tran/constants"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// Retired remembers the passwords that were used or expired for constants.RETIRED_CODE_RETENTION,
+// so that clients using them again learn why they are rejected.
+type Retired struct {
+	codes  map[string]retiredCode
+	pruned time.Time
+	mu     sync.Mutex
+}
+
+type retiredCode struct {
+	reason protocol.TranxErrorCode
+	at     time.Time
+}
+
+// NewRetired returns an empty set of retired passwords.
+func NewRetired() *Retired {
+	return &Retired{codes: map[string]retiredCode{}, pruned: time.Now()}
+}
+
+// Retire remembers the hashed password p and why it can no longer be used.
+func (r *Retired) Retire(p string, reason protocol.TranxErrorCode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.codes[p] = retiredCode{reason: reason, at: now}
+
+	// forget old passwords now and then instead of on every call
+	if now.Sub(r.pruned) < time.Minute {
+		return
+	}
+
+	for code, retired := range r.codes {
+		if now.Sub(retired.at) > constants.RETIRED_CODE_RETENTION {
+			delete(r.codes, code)
+		}
+	}
+
+	r.pruned = now
+}
+
+// Reason returns why the hashed password p was retired, it reports false if p is not retired.
+func (r *Retired) Reason(p string) (protocol.TranxErrorCode, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	retired, ok := r.codes[p]
+	if !ok || time.Since(retired.at) > constants.RETIRED_CODE_RETENTION {
+		return 0, false
+	}
+
+	return retired.reason, true
+}
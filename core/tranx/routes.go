@@ -4,5 +4,9 @@ import "github.com/abdfnx/tran/tools"
 
 func (s *Server) routes() {
 	s.router.HandleFunc("/establish-sender", tools.WebsocketHandler(s.handleEstablishSender()))
+	s.router.HandleFunc("/establish-broadcast-sender", tools.WebsocketHandler(s.handleEstablishBroadcastSender()))
 	s.router.HandleFunc("/establish-receiver", tools.WebsocketHandler(s.handleEstablishReceiver()))
+	s.router.HandleFunc("/establish-requester", tools.WebsocketHandler(s.handleEstablishRequester()))
+	s.router.HandleFunc("/establish-requested-sender", tools.WebsocketHandler(s.handleEstablishRequestedSender()))
+	s.router.HandleFunc("/health", s.handleHealth())
 }
@@ -1,9 +1,9 @@
 package tranx
 
 import (
-	"os"
 	"fmt"
 	"log"
+	"net"
 	"sync"
 	"time"
 	"context"
@@ -16,10 +16,11 @@ type Server struct {
 	router     *http.ServeMux
 	mailboxes  *Mailboxes
 	ids        *IDs
-	signal     chan os.Signal
+	retired    *Retired
+	logger     *log.Logger
 }
 
-// NewServer constructs a new Server struct and setups the routes.
+// NewServer constructs a new Server struct and setups the routes, Start serves it on port.
 func NewServer(port int) *Server {
 	router := &http.ServeMux{}
 
@@ -33,6 +34,8 @@ func NewServer(port int) *Server {
 		router:    router,
 		mailboxes: &Mailboxes{&sync.Map{}},
 		ids:       &IDs{&sync.Map{}},
+		retired:   NewRetired(),
+		logger:    log.Default(),
 	}
 
 	s.routes()
@@ -40,43 +43,40 @@ func NewServer(port int) *Server {
 	return s
 }
 
-// Start runs the tranx server.
-func (s *Server) Start() {
-	ctx, cancel := context.WithCancel(context.Background())
+// WithLogger specifies the logger of the server, the standard logger is used by default.
+func WithLogger(s *Server, logger *log.Logger) *Server {
+	s.logger = logger
 
-	go func() {
-		<-s.signal
-		cancel()
-	}()
-
-	if err := serve(s, ctx); err != nil {
-		log.Printf("Error serving Tran tranx server: %s\n", err)
-	}
+	return s
 }
 
-// serve is a helper function providing graceful shutdown of the server.
-func serve(s *Server, ctx context.Context) (err error) {
-	go func() {
-		if err = s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Serving Tran: %s\n", err)
-		}
-	}()
+// Start runs the tranx server on the port it was constructed with until Stop is called.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("serving Tran: %w", err)
+	}
 
-	log.Printf("Tran Tranx Server started at \"%s\" \n", s.httpServer.Addr)
-	<-ctx.Done()
+	return s.Serve(listener)
+}
 
-	ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer func() {
-		cancel()
-	}()
+// Serve runs the tranx server on listener until Stop is called, which makes it return nil.
+func (s *Server) Serve(listener net.Listener) error {
+	s.logger.Printf("Tran Tranx Server started at \"%s\" \n", listener.Addr())
 
-	if err = s.httpServer.Shutdown(ctxShutdown); err != nil {
-		log.Fatalf("Tran tranx shutdown failed: %s", err)
+	if err := s.httpServer.Serve(listener); err != http.ErrServerClosed {
+		return fmt.Errorf("serving Tran: %w", err)
 	}
 
-	if err == http.ErrServerClosed {
-		err = nil
+	return nil
+}
+
+// Stop shuts the server down gracefully, it waits for open requests until ctx is done.
+// Relayed websocket connections are not waited for and stay open until a client closes them.
+func (s *Server) Stop(ctx context.Context) error {
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("tran tranx shutdown failed: %w", err)
 	}
 
-	return err
+	return nil
 }
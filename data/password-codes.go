@@ -1,6 +1,18 @@
 package data
 
-var PasswordList = []string{
+// DefaultWordlist is the name of the wordlist passwords are made of if none is configured.
+const DefaultWordlist = "english"
+
+// Wordlists maps the names of the wordlists passwords can be made of to their words.
+var Wordlists = map[string][]string{
+	"english": English,
+	"french":  French,
+	"italian": Italian,
+	"spanish": Spanish,
+}
+
+// Legacy is the wordlist of older versions, passwords made of it are still accepted.
+var Legacy = []string{
 	"go",
 	"rust",
 	"solar",
@@ -18,7 +30,6 @@ var PasswordList = []string{
 	"mass",
 	"football",
 	"nebula",
-	"orbit",
 	"ios",
 	"lightyear",
 	"parsec",
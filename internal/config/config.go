@@ -9,15 +9,26 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/abdfnx/tran/dfs"
+	"github.com/abdfnx/tran/data"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models"
+	"github.com/abdfnx/tran/constants"
 )
 
 // TranConfig struct represents the config for the config.
 type TranConfig struct {
-	StartDir         string `mapstructure:"start_dir"`
-	Borderless       bool   `mapstructure:"borderless"`
-	Editor		     string `mapstructure:"editor"`
-	EnableMouseWheel bool   `mapstructure:"enable_mousewheel"`
-	ShowUpdates	     bool   `mapstructure:"show_updates"`
+	StartDir         string          `mapstructure:"start_dir"`
+	Borderless       bool            `mapstructure:"borderless"`
+	Editor		     string          `mapstructure:"editor"`
+	EnableMouseWheel bool            `mapstructure:"enable_mousewheel"`
+	ShowUpdates	     bool            `mapstructure:"show_updates"`
+	Timeouts         models.Timeouts `mapstructure:"timeouts"`
+	Direct           models.Direct   `mapstructure:"direct"`
+	Relays           []string        `mapstructure:"relays"`
+	Password         models.PasswordOptions `mapstructure:"password"`
+	Accept           models.AcceptRules     `mapstructure:"accept"`
+	Streams          int             `mapstructure:"streams"`
+	Compression      string          `mapstructure:"compression"`
 }
 
 // Config represents the main config for the application.
@@ -67,6 +78,26 @@ func LoadConfig(startDir *pflag.Flag) {
 	viper.SetDefault("config.editor", defaultEditor())
 	viper.SetDefault("config.show_updates", true)
 
+	defaultTimeouts := models.DefaultTimeouts()
+	viper.SetDefault("config.timeouts.connect", defaultTimeouts.Connect.String())
+	viper.SetDefault("config.timeouts.rendezvous", defaultTimeouts.Rendezvous.String())
+	viper.SetDefault("config.timeouts.key_exchange", defaultTimeouts.KeyExchange.String())
+	viper.SetDefault("config.timeouts.handshake", defaultTimeouts.Handshake.String())
+	viper.SetDefault("config.timeouts.prepare", defaultTimeouts.Prepare.String())
+	viper.SetDefault("config.timeouts.review", defaultTimeouts.Review.String())
+	viper.SetDefault("config.timeouts.transfer", defaultTimeouts.Transfer.String())
+	viper.SetDefault("config.timeouts.close", defaultTimeouts.Close.String())
+	viper.SetDefault("config.direct.disabled", false)
+	viper.SetDefault("config.direct.ports", "")
+	viper.SetDefault("config.direct.bind", "")
+	viper.SetDefault("config.relays", []string{})
+	viper.SetDefault("config.password.words", tools.DefaultPasswordWords)
+	viper.SetDefault("config.password.wordlist", data.DefaultWordlist)
+	viper.SetDefault("config.accept.max_size", "")
+	viper.SetDefault("config.accept.max_files", 0)
+	viper.SetDefault("config.streams", 0)
+	viper.SetDefault("config.compression", "auto")
+
 	if err := viper.SafeWriteConfig(); err != nil {
 		if os.IsNotExist(err) {
 			err = viper.WriteConfig()
@@ -101,3 +132,18 @@ func GetConfig() (config Config) {
 
 	return
 }
+
+// TranOptions returns the options for transfers as configured by the user.
+func (c Config) TranOptions() models.TranOptions {
+	return models.TranOptions{
+		TranxAddress: constants.DEFAULT_ADDRESS,
+		TranxPort:    constants.DEFAULT_PORT,
+		Relays:       c.Tran.Relays,
+		Timeouts:     c.Tran.Timeouts,
+		Direct:       c.Tran.Direct,
+		Password:     c.Tran.Password,
+		Accept:       c.Tran.Accept,
+		Streams:      c.Tran.Streams,
+		Compression:  c.Tran.Compression,
+	}
+}
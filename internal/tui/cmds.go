@@ -9,9 +9,7 @@ import (
 	"path/filepath"
 
 	"github.com/abdfnx/tran/dfs"
-	"github.com/abdfnx/tran/models"
 	"github.com/abdfnx/tran/renderer"
-	"github.com/abdfnx/tran/constants"
 	"github.com/charmbracelet/lipgloss"
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -242,12 +240,11 @@ func (b Bubble) receiveFileCmd(password string) tea.Cmd {
 			return err
 		}
 
-		HandleReceiveCommand(models.TranOptions{
-			TranxAddress: constants.DEFAULT_ADDRESS,
-			TranxPort:    constants.DEFAULT_PORT,
-		}, password)
+		if err := HandleReceiveCommand(b.appConfig.TranOptions(), password); err != nil {
+			return errorMsg(err.Error())
+		}
 
-		return nil
+		return tea.Quit()
 	}
 }
 
@@ -0,0 +1,100 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/constants"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/textinput"
+)
+
+// maxShownMatches is the number of words shown that the word being entered can still become.
+const maxShownMatches = 8
+
+type codePromptModel struct {
+	textinput textinput.Model
+	matches   []string
+	code      string
+	cancelled bool
+}
+
+// PromptCode asks for the password or link of a transfer, tab completes the word being entered from the wordlists.
+// It returns tools.CancelError if the user quits instead.
+func PromptCode() (string, error) {
+	t := textinput.New()
+	t.Prompt = "❯ "
+	t.CharLimit = 250
+	t.Placeholder = "Enter the password or tran:// link"
+	t.Focus()
+
+	m, err := tea.NewProgram(codePromptModel{textinput: t}).Run()
+	if err != nil {
+		return "", err
+	}
+
+	prompt := m.(codePromptModel)
+	if prompt.cancelled {
+		return "", tools.CancelError
+	}
+
+	return prompt.code, nil
+}
+
+func (codePromptModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m codePromptModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+			case "tab":
+				var code string
+				code, m.matches = tools.CompleteCode(m.textinput.Value())
+				m.textinput.SetValue(code)
+				m.textinput.CursorEnd()
+
+				return m, nil
+
+			case "enter":
+				if strings.TrimSpace(m.textinput.Value()) == "" {
+					return m, nil
+				}
+
+				m.code = m.textinput.Value()
+
+				return m, tea.Quit
+
+			case "esc", "ctrl+c":
+				m.cancelled = true
+
+				return m, tea.Quit
+		}
+
+		m.matches = nil
+	}
+
+	var cmd tea.Cmd
+	m.textinput, cmd = m.textinput.Update(msg)
+
+	return m, cmd
+}
+
+func (m codePromptModel) View() string {
+	if m.code != "" || m.cancelled {
+		return ""
+	}
+
+	view := "\n" + constants.PadText + m.textinput.View() + "\n\n"
+
+	if len(m.matches) > 1 {
+		matches := m.matches
+		if len(matches) > maxShownMatches {
+			matches = append(matches[:maxShownMatches:maxShownMatches], constants.EllipsisStyle)
+		}
+
+		view += constants.PadText + constants.InfoStyle(strings.Join(matches, "  ")) + "\n\n"
+	}
+
+	return view + constants.PadText + constants.HelpStyle("(tab completes the word, esc cancels)") + "\n"
+}
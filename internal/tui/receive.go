@@ -2,121 +2,142 @@ package tui
 
 import (
 	"os"
-	"fmt"
 	"math"
 	"time"
+	"syscall"
+	"context"
+	"os/signal"
 
-	"github.com/gorilla/websocket"
+	"github.com/mattn/go-isatty"
 	"github.com/abdfnx/tran/tools"
 	"github.com/abdfnx/tran/models"
 	"github.com/abdfnx/tran/constants"
-	"github.com/abdfnx/tran/core/receiver"
-	"github.com/abdfnx/tran/models/protocol"
+	"github.com/abdfnx/tran/pkg/tranclient"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-// HandleReceiveCommand is the receive application.
-func HandleReceiveCommand(programOptions models.TranOptions, password string) {
-	// communicate ui updates on this channel between receiverClient and handleReceiveCommand
-	uiCh := make(chan receiver.UIUpdate)
-	// initialize a receiverClient with a UI
-	receiverClient := receiver.WithUI(receiver.NewReceiver(programOptions), uiCh)
+// HandleReceiveCommand is the receive application, it returns once the transfer has ended and the UI is closed.
+// Quitting the UI cancels the transfer.
+func HandleReceiveCommand(programOptions models.TranOptions, password string) error {
 	// initialize and start receiver-UI
 	receiverUI := NewReceiverUI()
+	interactive := isInteractive()
 	// clean up temporary files previously created by this command
 	tools.RemoveTemporaryFiles(constants.RECEIVE_TEMP_FILE_NAME_PREFIX)
 
-	go initReceiverUI(receiverUI)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	uiDone := startUI(receiverUI, cancel)
 	time.Sleep(constants.START_PERIOD)
-	go listenForReceiverUIUpdates(receiverUI, uiCh)
 
-	parsedPassword, err := tools.ParsePassword(password)
-	if err != nil {
-		receiverUI.Send(ErrorMsg{Message: "Error parsing password, make sure you entered a correctly formatted password (e.g. 1-gamma-ray-quasar)."})
-		GracefulUIQuit()
-	}
+	// receive the files into the current working directory
+	result, err := tranclient.Receive(ctx, tranclient.Options{
+		TranOptions: programOptions,
+		OnEvent:     receiverUIEvents(receiverUI),
+		Review:      manifestReviewer(receiverUI, programOptions.Accept, interactive),
+	}, password, tranclient.DirSink(""))
 
-	// initiate communications with tranx-server
-	wsConnCh := make(chan *websocket.Conn)
-	go initiateReceiverTranxCommunication(receiverClient, receiverUI, parsedPassword, wsConnCh)
+	if err != nil {
+		receiverUI.Send(receiveErrorMsg(err, interactive))
 
-	// keeps program alive until finished
-	doneCh := make(chan bool)
-	// start receiving files
-	go startReceiving(receiverClient, receiverUI, <-wsConnCh, doneCh)
+		return quitUI(receiverUI, uiDone, err)
+	}
 
 	// wait for shut down to render final UI
-	<-doneCh
-	GracefulUIQuit()
-}
+	receiverUI.Send(FinishedMsg{Files: result.Files, PayloadSize: result.Size})
 
-func initReceiverUI(receiverUI *tea.Program) {
-	go func() {
-		if err := receiverUI.Start(); err != nil {
-			fmt.Println("Error initializing UI", err)
-			os.Exit(1)
-		}
-
-		os.Exit(0)
-	}()
+	return quitUI(receiverUI, uiDone, nil)
 }
 
-func listenForReceiverUIUpdates(receiverUI *tea.Program, uiCh chan receiver.UIUpdate) {
-	latestProgress := 0
+// HandleRequestCommand is the request application, it shows the password the sender sends the files with
+// and returns once the transfer has ended and the UI is closed. Quitting the UI cancels the transfer.
+func HandleRequestCommand(programOptions models.TranOptions) error {
+	// initialize and start receiver-UI
+	receiverUI := NewReceiverUI()
+	interactive := isInteractive()
+	// clean up temporary files previously created by this command
+	tools.RemoveTemporaryFiles(constants.RECEIVE_TEMP_FILE_NAME_PREFIX)
 
-	for uiUpdate := range uiCh {
-		// limit progress update ui-send events
-		newProgress := int(math.Ceil(100 * float64(uiUpdate.Progress)))
-		if newProgress > latestProgress {
-			latestProgress = newProgress
-			receiverUI.Send(ProgressMsg{Progress: uiUpdate.Progress})
-		}
-	}
-}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-func initiateReceiverTranxCommunication(receiverClient *receiver.Receiver, receiverUI *tea.Program, password models.Password, connectionCh chan *websocket.Conn) {
-	wsConn, err := receiverClient.ConnectToTranx(receiverClient.TranxAddress(), receiverClient.TranxPort(), password)
-	if err != nil {
-		receiverUI.Send(ErrorMsg{Message: "Something went wrong during connection-negotiation (did you enter the correct password?)"})
-		GracefulUIQuit()
-	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	receiverUI.Send(FileInfoMsg{Bytes: receiverClient.PayloadSize()})
-	connectionCh <- wsConn
-}
+	uiDone := startUI(receiverUI, cancel)
+	time.Sleep(constants.START_PERIOD)
 
-func startReceiving(receiverClient *receiver.Receiver, receiverUI *tea.Program, wsConnection *websocket.Conn, doneCh chan bool) {
-	tempFile, err := os.CreateTemp(os.TempDir(), constants.RECEIVE_TEMP_FILE_NAME_PREFIX)
+	// request the files into the current working directory
+	session, err := tranclient.Request(ctx, tranclient.Options{
+		TranOptions: programOptions,
+		OnEvent:     receiverUIEvents(receiverUI),
+		Review:      manifestReviewer(receiverUI, programOptions.Accept, interactive),
+	}, tranclient.DirSink(""))
 
 	if err != nil {
-		receiverUI.Send(ErrorMsg{Message: "Something went wrong when creating the received file container."})
-		GracefulUIQuit()
+		receiverUI.Send(NewTransferErrorMsg("sender", "Requesting failed", err))
+
+		return quitUI(receiverUI, uiDone, err)
 	}
 
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
+	receiverUI.Send(PasswordMsg{
+		Password: session.Code(),
+		Link:     session.Link(),
+		Entropy:  tools.PasswordEntropy(programOptions.Password),
+	})
 
-	// start receiving files from sender
-	err = receiverClient.Receive(wsConnection, tempFile)
+	result, err := session.Wait()
 	if err != nil {
-		receiverUI.Send(ErrorMsg{Message: "Something went wrong during file transfer."})
-		GracefulUIQuit()
-	}
+		receiverUI.Send(receiveErrorMsg(err, interactive))
 
-	if receiverClient.UsedRelay() {
-		wsConnection.WriteJSON(protocol.TranxMessage{Type: protocol.ReceiverToTranxClose})
+		return quitUI(receiverUI, uiDone, err)
 	}
 
-	// reset file position for reading
-	tempFile.Seek(0, 0)
+	// wait for shut down to render final UI
+	receiverUI.Send(FinishedMsg{Files: result.Files, PayloadSize: result.Size})
 
-	// read received bytes from tmpFile
-	receivedFileNames, decompressedSize, err := tools.DecompressAndUnarchiveBytes(tempFile)
-	if err != nil {
-		receiverUI.Send(ErrorMsg{Message: "Something went wrong when expanding the received files."})
-		GracefulUIQuit()
+	return quitUI(receiverUI, uiDone, nil)
+}
+
+// receiveErrorMsg returns the ErrorMsg of a failed receive, it explains how to accept files if they were declined for lack of a terminal.
+func receiveErrorMsg(err error, interactive bool) ErrorMsg {
+	if tranclient.KindOf(err) == tranclient.KindDeclined {
+		message := "The files were declined"
+		if !interactive {
+			message += ", " + headlessDeclineHint
+		}
+
+		return ErrorMsg{Message: message}
 	}
 
-	receiverUI.Send(FinishedMsg{Files: receivedFileNames, PayloadSize: decompressedSize})
-	doneCh <- true
+	return NewTransferErrorMsg("sender", "Receiving failed", err)
+}
+
+// isInteractive reports whether the files can be reviewed on the terminal of stdin.
+func isInteractive() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+}
+
+// receiverUIEvents returns an event handler that reports the state of the receive to the receiver-UI.
+func receiverUIEvents(receiverUI *tea.Program) func(tranclient.Event) {
+	latestProgress := 0
+
+	return func(event tranclient.Event) {
+		switch event.Type {
+			case tranclient.EventFileInfo:
+				receiverUI.Send(FileInfoMsg{Bytes: event.Bytes})
+
+			case tranclient.EventProgress:
+				// limit progress update ui-send events
+				newProgress := int(math.Ceil(100 * float64(event.Progress)))
+				if newProgress > latestProgress {
+					latestProgress = newProgress
+					receiverUI.Send(ProgressMsg{Progress: event.Progress})
+				}
+		}
+	}
 }
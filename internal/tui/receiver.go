@@ -19,6 +19,7 @@ type uiState int
 // ui state flows from the top down
 const (
 	showEstablishing uiState = iota
+	showReview
 	showReceivingProgress
 	showFinished
 	showError
@@ -32,6 +33,10 @@ type receiverUIModel struct {
 	spinner                 spinner.Model
 	progressBar             progress.Model
 	errorMessage            string
+	password                string
+	link                    string
+	entropy                 float64
+	review                  manifestReview
 }
 
 func NewReceiverUI() *tea.Program {
@@ -64,6 +69,13 @@ func (m receiverUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			return m, nil
 
+		// the payload is received once the receiver accepted it
+		case ManifestMsg:
+			m.state = showReview
+			m.review = newManifestReview(msg)
+
+			return m, nil
+
 		case ProgressMsg:
 			m.state = showReceivingProgress
 			cmd := m.progressBar.SetPercent(float64(msg.Progress))
@@ -78,6 +90,14 @@ func (m receiverUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			return m, cmd
 
+		// the receiver requested the files, the sender sends them with the password
+		case PasswordMsg:
+			m.password = msg.Password
+			m.link = msg.Link
+			m.entropy = msg.Entropy
+
+			return m, nil
+
 		case ErrorMsg:
 			m.state = showError
 			m.errorMessage = msg.Message
@@ -89,6 +109,13 @@ func (m receiverUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, tea.Quit
 			}
 
+			if m.state == showReview && m.review.update(msg.String()) {
+				m.state = showReceivingProgress
+				m.resetSpinner()
+
+				return m, spinner.Tick
+			}
+
 			return m, nil
 
 		case tea.WindowSizeMsg:
@@ -117,9 +144,32 @@ func (m receiverUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m receiverUIModel) View() string {
 	switch m.state {
 		case showEstablishing:
-			return "\n" +
+			establishingText := "\n" +
 				constants.PadText + constants.InfoStyle(fmt.Sprintf("%s Establishing connection with sender", m.spinner.View())) + "\n\n"
 
+			if m.password == "" {
+				return establishingText
+			}
+
+			requestText := constants.PadText + "On the other computer, run " +
+				constants.HelpStyle("`tran send --to "+m.password+" <FILE || DIRECTORY>`") + " to send the files" + "\n\n" +
+				constants.PadText + "This is the password: " + constants.BoldText(m.password)
+
+			if m.entropy > 0 {
+				requestText += fmt.Sprintf(" (~%.0f bits of entropy)", m.entropy)
+			}
+
+			requestText += "\n\n"
+
+			if m.link != "" {
+				requestText += constants.PadText + "Or send to this link: " + constants.BoldText(m.link) + "\n\n"
+			}
+
+			return establishingText + requestText
+
+		case showReview:
+			return m.review.view()
+
 		case showReceivingProgress:
 			payloadSize := constants.BoldText(tools.ByteCountSI(m.payloadSize))
 			receivingText := fmt.Sprintf("%s Receiving files (total size %s)", m.spinner.View(), payloadSize)
@@ -0,0 +1,257 @@
+package tui
+
+import (
+	"fmt"
+	"context"
+	"strings"
+
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models"
+	"github.com/abdfnx/tran/constants"
+	"github.com/abdfnx/tran/pkg/tranclient"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// reviewRows is how many files of the manifest are listed at once.
+const reviewRows = 10
+
+// ManifestMsg asks the receiver to review the manifest of the payload, the decision is sent on Answer.
+type ManifestMsg struct {
+	Manifest *tranclient.Manifest
+	Answer   chan<- tranclient.Decision
+}
+
+// reviewRow is a line of the tree of the manifest, a directory or a file.
+type reviewRow struct {
+	name  string
+	path  string
+	depth int
+	file  int // index of the file in the manifest, -1 for directories
+}
+
+// manifestReview is the state of the review of a manifest, shown as a tree in which every file can be picked or left out.
+type manifestReview struct {
+	manifest *tranclient.Manifest
+	answer   chan<- tranclient.Decision
+	rows     []reviewRow
+	picked   []bool
+	cursor   int
+}
+
+func newManifestReview(msg ManifestMsg) manifestReview {
+	picked := make([]bool, len(msg.Manifest.Files))
+	for i := range picked {
+		picked[i] = true
+	}
+
+	return manifestReview{manifest: msg.Manifest, answer: msg.Answer, rows: reviewTree(msg.Manifest.Files), picked: picked}
+}
+
+// reviewTree returns the rows of the files, each one preceded by the directories not listed before it.
+// The files of a directory are listed one after the other, as the sender walks the directories.
+func reviewTree(files []tranclient.ManifestFile) []reviewRow {
+	var rows []reviewRow
+	listed := map[string]bool{}
+
+	for i, file := range files {
+		parts := strings.Split(file.Path, "/")
+
+		for depth := range parts[:len(parts) - 1] {
+			dir := strings.Join(parts[:depth + 1], "/")
+			if !listed[dir] {
+				listed[dir] = true
+				rows = append(rows, reviewRow{name: parts[depth] + "/", path: dir, depth: depth, file: -1})
+			}
+		}
+
+		rows = append(rows, reviewRow{name: parts[len(parts) - 1], path: file.Path, depth: len(parts) - 1, file: i})
+	}
+
+	return rows
+}
+
+// filesOf returns the indexes of the files of the row, the files inside it for a directory.
+func (r manifestReview) filesOf(row reviewRow) []int {
+	if row.file >= 0 {
+		return []int{row.file}
+	}
+
+	var files []int
+	for i, file := range r.manifest.Files {
+		if strings.HasPrefix(file.Path, row.path + "/") {
+			files = append(files, i)
+		}
+	}
+
+	return files
+}
+
+// decide answers the review, only the picked files are requested unless all of them are.
+func (r manifestReview) decide(accept bool) {
+	decision := tranclient.Decision{Accept: accept}
+
+	if accept && r.pickedCount() < len(r.picked) {
+		for i, file := range r.manifest.Files {
+			if r.picked[i] {
+				decision.Only = append(decision.Only, file.Path)
+			}
+		}
+
+		// picking no file at all declines the payload
+		decision.Accept = len(decision.Only) > 0
+	}
+
+	r.answer <- decision
+}
+
+func (r manifestReview) pickedCount() int {
+	count := 0
+	for _, picked := range r.picked {
+		if picked {
+			count++
+		}
+	}
+
+	return count
+}
+
+// update handles the keys of the review, it reports whether the review was answered.
+func (r *manifestReview) update(key string) bool {
+	switch key {
+		case "y", "enter":
+			r.decide(true)
+			return true
+
+		case "n":
+			r.decide(false)
+			return true
+
+		case "up", "k":
+			if r.cursor > 0 {
+				r.cursor--
+			}
+
+		case "down", "j":
+			if r.cursor < len(r.rows) - 1 {
+				r.cursor++
+			}
+
+		// pick the file or all files of the directory, or leave them out if all are picked
+		case " ":
+			if len(r.rows) > 0 {
+				files := r.filesOf(r.rows[r.cursor])
+				all := r.pickedOf(files) < len(files)
+
+				for _, i := range files {
+					r.picked[i] = all
+				}
+			}
+
+		// pick all files, or none if all are picked
+		case "a":
+			all := r.pickedCount() < len(r.picked)
+			for i := range r.picked {
+				r.picked[i] = all
+			}
+	}
+
+	return false
+}
+
+func (r manifestReview) pickedOf(files []int) int {
+	count := 0
+	for _, i := range files {
+		if r.picked[i] {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (r manifestReview) view() string {
+	manifest := r.manifest
+	size := constants.BoldText(tools.ByteCountSI(manifest.Size))
+
+	text := fmt.Sprintf("The sender offers %d files (total size %s)", manifest.Count, size)
+	if manifest.Count == 0 {
+		text = fmt.Sprintf("The sender offers files of %s compressed, without listing them", size)
+	}
+
+	reviewText := "\n" + constants.PadText + constants.InfoStyle(text) + "\n\n"
+
+	if manifest.Note != "" {
+		reviewText += constants.PadText + "Note: " + constants.ItalicText(manifest.Note) + "\n\n"
+	}
+
+	// list the rows around the cursor
+	first := r.cursor - reviewRows / 2
+	if first > len(r.rows) - reviewRows {
+		first = len(r.rows) - reviewRows
+	}
+
+	if first < 0 {
+		first = 0
+	}
+
+	for i := first; i < len(r.rows) && i < first + reviewRows; i++ {
+		row := r.rows[i]
+		files := r.filesOf(row)
+
+		pointer, check := " ", "[ ]"
+		if i == r.cursor {
+			pointer = ">"
+		}
+
+		switch picked := r.pickedOf(files); {
+			case picked == len(files):
+				check = "[x]"
+
+			case picked > 0:
+				check = "[-]"
+		}
+
+		name := row.name
+		if row.file >= 0 {
+			name += fmt.Sprintf(" (%s)", tools.ByteCountSI(manifest.Files[row.file].Size))
+		}
+
+		reviewText += constants.PadText + fmt.Sprintf("%s %s %s%s", pointer, check, strings.Repeat("  ", row.depth), name) + "\n"
+	}
+
+	if manifest.Truncated() {
+		reviewText += constants.PadText + constants.HelpStyle(fmt.Sprintf("and %d files more, which are received if all listed files are picked", manifest.Count - len(manifest.Files))) + "\n"
+	}
+
+	return reviewText + "\n" +
+		constants.PadText + constants.HelpStyle("(y/enter to receive the picked files, n to decline, space to pick a file or directory, a to pick all)") + "\n\n" +
+		constants.PadText + constants.QuitCommandsHelpText + "\n\n"
+}
+
+// manifestReviewer returns the review of the receive, payloads the rules allow are accepted right away.
+// Otherwise the receiver-UI asks for a decision if interactive is set, without a terminal to ask on the payload is declined.
+func manifestReviewer(receiverUI *tea.Program, rules models.AcceptRules, interactive bool) func(context.Context, *tranclient.Manifest) tranclient.Decision {
+	return func(ctx context.Context, manifest *tranclient.Manifest) tranclient.Decision {
+		if allowed, err := rules.Allows(manifest.Count, manifest.Size); err == nil && allowed {
+			return tranclient.Decision{Accept: true}
+		}
+
+		if !interactive {
+			return tranclient.Decision{}
+		}
+
+		answer := make(chan tranclient.Decision, 1)
+		receiverUI.Send(ManifestMsg{Manifest: manifest, Answer: answer})
+
+		select {
+			case decision := <-answer:
+				return decision
+
+			case <-ctx.Done():
+				return tranclient.Decision{}
+		}
+	}
+}
+
+// headlessDeclineHint explains how to accept files without a terminal to review them on.
+const headlessDeclineHint = "there is no terminal to review the files on, pass --yes or set accept.max_size or accept.max_files in the config to accept files without asking"
@@ -3,6 +3,7 @@ package tui
 import (
 	"fmt"
 	"sort"
+	"time"
 	"strings"
 
 	"github.com/abdfnx/tran/constants"
@@ -30,6 +31,12 @@ type senderUIModel struct {
 	fileNames    []string
 	payloadSize  int64
 	password     string
+	link         string
+	entropy      float64
+	expires      time.Time
+	maxReceivers int
+	progress     map[int]float32
+	eta          time.Duration
 	readyToSend  bool
 	spinner      spinner.Model
 	progressBar  progress.Model
@@ -39,7 +46,11 @@ type senderUIModel struct {
 type ReadyMsg struct{}
 
 type PasswordMsg struct {
-	Password string
+	Password  string
+	Link      string
+	Entropy   float64   // estimated entropy of the password in bits
+	Receivers int       // receivers that can receive the files with the password, one if zero
+	Expires   time.Time // when the password expires, it does not if zero
 }
 
 func NewSenderUI() *tea.Program {
@@ -74,26 +85,44 @@ func (m senderUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		case PasswordMsg:
 			m.password = msg.Password
+			m.link = msg.Link
+			m.entropy = msg.Entropy
+			m.maxReceivers = msg.Receivers
+			m.expires = msg.Expires
 
 			return m, nil
 
+		// every receiver of a broadcast gets a progress bar of its own
 		case ProgressMsg:
+			if m.maxReceivers > 1 {
+				if m.progress == nil {
+					m.progress = map[int]float32{}
+				}
+
+				m.progress[msg.Receiver] = msg.Progress
+			}
+
 			if m.state != showSendingProgress {
 				m.state = showSendingProgress
 				m.resetSpinner()
 				return m, spinner.Tick
 			}
 
-			if m.progressBar.Percent() == 1.0 {
+			if m.maxReceivers > 1 || m.progressBar.Percent() == 1.0 {
 				return m, nil
 			}
 
+			m.eta = msg.ETA
 			cmd := m.progressBar.SetPercent(float64(msg.Progress))
 
 			return m, cmd
 
 		case FinishedMsg:
 			m.state = showSFinished
+			for receiver := range m.progress {
+				m.progress[receiver] = 1
+			}
+
 			cmd := m.progressBar.SetPercent(1.0)
 
 			return m, cmd
@@ -160,15 +189,43 @@ func (m senderUIModel) View() string {
 
 	switch m.state {
 		case showPassword, showPasswordWithCopy:
+			// the receiver that requested the files knows the password
+			if m.password == "" {
+				return "\n" + constants.PadText + constants.InfoStyle(fileInfoText) + "\n\n"
+			}
+
+			passwordText := m.passwordView()
+
 			return "\n" +
 				constants.PadText + constants.InfoStyle(fileInfoText) + "\n\n" +
 				constants.PadText + "On the other computer, press " + constants.HelpStyle("`ctrl+r`") + " to enable receive mode and then enter the password:" + "\n\n" +
-				constants.PadText + "This is the password: " + constants.BoldText(m.password) + "\n\n"
+				passwordText
 
 		case showSendingProgress:
+			if m.maxReceivers > 1 {
+				// further receivers can still join with the password
+				passwordText := ""
+				if len(m.progress) < m.maxReceivers {
+					passwordText = m.passwordView()
+				}
+
+				return "\n" +
+					constants.PadText + constants.InfoStyle(fileInfoText) + "\n\n" +
+					passwordText +
+					m.receiversView() +
+					constants.PadText + constants.QuitCommandsHelpText + "\n\n"
+			}
+
+			// the time left is known once the receiver acknowledged some of the payload
+			etaText := ""
+			if m.eta >= time.Second {
+				etaText = constants.PadText + constants.HelpStyle(fmt.Sprintf("About %s left", m.eta.Round(time.Second))) + "\n\n"
+			}
+
 			return "\n" +
 				constants.PadText + constants.InfoStyle(fileInfoText) + "\n\n" +
 				constants.PadText + m.progressBar.View() + "\n\n" +
+				etaText +
 				constants.PadText + constants.QuitCommandsHelpText + "\n\n"
 
 		case showSFinished:
@@ -176,6 +233,13 @@ func (m senderUIModel) View() string {
 			indentedWrappedFiles := indent.String(fmt.Sprintf("Sent: %s", wordwrap.String(constants.ItalicText(TopLevelFilesText(m.fileNames)), constants.MAX_WIDTH)), constants.PADDING)
 			finishedText := fmt.Sprintf("Sent %d objects (%s decompressed)\n\n%s", len(m.fileNames), payloadSize, indentedWrappedFiles)
 
+			if m.maxReceivers > 1 {
+				return "\n" +
+					constants.PadText + constants.InfoStyle(finishedText) + "\n\n" +
+					m.receiversView() +
+					constants.PadText + constants.QuitCommandsHelpText + "\n\n"
+			}
+
 			return "\n" +
 				constants.PadText + constants.InfoStyle(finishedText) + "\n\n" +
 				constants.PadText + m.progressBar.View() + "\n\n" +
@@ -189,6 +253,64 @@ func (m senderUIModel) View() string {
 	}
 }
 
+// passwordView shows the password and the link to share it with the receivers.
+func (m senderUIModel) passwordView() string {
+	passwordText := constants.PadText + "This is the password: " + constants.BoldText(m.password)
+
+	if m.entropy > 0 {
+		passwordText += fmt.Sprintf(" (~%.0f bits of entropy)", m.entropy)
+	}
+
+	passwordText += "\n\n"
+
+	// the view is rendered with every frame of the spinner, which keeps the countdown running
+	if !m.expires.IsZero() {
+		remaining := time.Until(m.expires).Round(time.Second)
+		expiryText := fmt.Sprintf("The password expires in %s", remaining)
+
+		if remaining <= 0 {
+			expiryText = "The password has expired"
+		}
+
+		passwordText += constants.PadText + constants.HelpStyle(expiryText) + "\n\n"
+	}
+
+	if m.entropy > 0 && m.entropy < tools.WeakPasswordEntropy {
+		passwordText += constants.PadText + constants.HelpStyle("This password is weak, whoever guesses it first receives the files") + "\n\n"
+	}
+
+	if m.maxReceivers > 1 {
+		passwordText += constants.PadText + constants.HelpStyle(fmt.Sprintf("Up to %d receivers can use the password", m.maxReceivers)) + "\n\n"
+	}
+
+	if m.link != "" {
+		passwordText += constants.PadText + "Or share this link: " + constants.BoldText(m.link) + "\n\n"
+	}
+
+	return passwordText
+}
+
+// receiversView lists the progress of every receiver of a broadcast that joined.
+func (m senderUIModel) receiversView() string {
+	receivers := make([]int, 0, len(m.progress))
+	for receiver := range m.progress {
+		receivers = append(receivers, receiver)
+	}
+
+	sort.Ints(receivers)
+
+	view := ""
+	for _, receiver := range receivers {
+		label := fmt.Sprintf("Receiver %d ", receiver)
+		bar := m.progressBar
+		bar.Width -= len(label)
+
+		view += constants.PadText + label + bar.ViewAs(float64(m.progress[receiver])) + "\n\n"
+	}
+
+	return view
+}
+
 func (m *senderUIModel) resetSpinner() {
 	m.spinner = spinner.NewModel()
 	m.spinner.Style = lipgloss.NewStyle().Foreground(lipgloss.Color(constants.PRIMARY_COLOR))
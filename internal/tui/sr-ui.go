@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"sort"
 	"time"
+	"errors"
+	"context"
 	"strings"
 
 	"github.com/abdfnx/tran/constants"
+	"github.com/abdfnx/tran/models/protocol"
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/bubbles/spinner"
 )
 
@@ -23,8 +27,21 @@ type ErrorMsg struct {
 	Message string
 }
 
+// NewTransferErrorMsg returns the ErrorMsg of a failed transfer,
+// it shows the reason the peer gave if the peer aborted the transfer.
+func NewTransferErrorMsg(peer string, fallback string, err error) ErrorMsg {
+	var peerErr *protocol.PeerError
+	if errors.As(err, &peerErr) {
+		return ErrorMsg{Message: fmt.Sprintf("The %s aborted the transfer: %s", peer, peerErr.Message)}
+	}
+
+	return ErrorMsg{Message: fmt.Sprintf("%s: %s", fallback, err)}
+}
+
 type ProgressMsg struct {
 	Progress float32
+	ETA      time.Duration // estimated time left, zero if unknown
+	Receiver int // receiver the progress is about when sending to several receivers, counting from one
 }
 
 type FinishedMsg struct {
@@ -80,6 +97,31 @@ func TopLevelFilesText(fileNames []string) string {
 	return strings.Join(topLevelFilesText, ", ")
 }
 
+// startUI runs the UI in the background and calls cancel once it has quit, the returned channel reports its error.
+func startUI(ui *tea.Program, cancel context.CancelFunc) <-chan error {
+	uiDone := make(chan error, 1)
+
+	go func() {
+		_, err := ui.Run()
+		cancel()
+		uiDone <- err
+	}()
+
+	return uiDone
+}
+
+// quitUI gives the UI time to render its final state, quits it and returns err, or the error of the UI if err is nil.
+func quitUI(ui *tea.Program, uiDone <-chan error, err error) error {
+	GracefulUIQuit()
+	ui.Quit()
+
+	if uiErr := <-uiDone; err == nil && uiErr != nil {
+		return fmt.Errorf("error running the UI: %w", uiErr)
+	}
+
+	return err
+}
+
 func GracefulUIQuit() {
 	time.Sleep(constants.SHUTDOWN_PERIOD)
 }
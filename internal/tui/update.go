@@ -8,6 +8,7 @@ import (
 
 	"github.com/muesli/termenv"
 	"github.com/abdfnx/tran/dfs"
+	"github.com/abdfnx/tran/tools"
 	"github.com/abdfnx/tran/constants"
 	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
@@ -327,7 +328,7 @@ func (b *Bubble) handleKeys(msg tea.KeyMsg) tea.Cmd {
 			if !b.showCommandInput && !b.showBoxSpinner {
 				b.receiveMode = true
 				b.showCommandInput = true
-				b.textinput.Placeholder = "Enter the password"
+				b.textinput.Placeholder = "Enter the password or tran:// link"
 				b.textinput.Focus()
 
 				return textinput.Blink
@@ -355,6 +356,14 @@ func (b *Bubble) handleKeys(msg tea.KeyMsg) tea.Cmd {
 
 			return b.updateDirectoryListingCmd(dfs.CurrentDirectory)
 
+		// tab completes the words of the password while it is entered
+		case key.Matches(msg, b.keyMap.ToggleBox) && b.receiveMode && b.showCommandInput:
+			code, _ := tools.CompleteCode(b.textinput.Value())
+			b.textinput.SetValue(code)
+			b.textinput.CursorEnd()
+
+			return nil
+
 		case key.Matches(msg, b.keyMap.ToggleBox):
 			b.activeBox = (b.activeBox + 1) % 2
 	}
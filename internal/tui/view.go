@@ -1,17 +1,19 @@
 package tui
 
 import (
+	"os"
 	"fmt"
 	"io/fs"
+	"errors"
 	"strings"
 
 	"github.com/abdfnx/tran/dfs"
 	"github.com/abdfnx/tran/tools"
-	"github.com/abdfnx/tran/models"
 	"github.com/abdfnx/tran/renderer"
 	"github.com/abdfnx/tran/constants"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/muesli/reflow/truncate"
+	"github.com/abdfnx/tran/pkg/tranclient"
 )
 
 // statusBarView returns the status bar.
@@ -261,10 +263,18 @@ func (b Bubble) View() string {
 
 		fn := []string{selectedFile.Name()}
 
-		HandleSendCommand(models.TranOptions{
-			TranxAddress: constants.DEFAULT_ADDRESS,
-			TranxPort:    constants.DEFAULT_PORT,
-		}, fn)
+		// the send takes over the terminal, tran ends with it
+		if err := HandleSendCommand(b.appConfig.TranOptions(), fn); err != nil {
+			// the send UI has shown the error of the transfer already
+			var transferErr *tranclient.Error
+			if !errors.As(err, &transferErr) {
+				fmt.Fprintln(os.Stderr, err)
+			}
+
+			os.Exit(1)
+		}
+
+		os.Exit(0)
 	}
 
 	var primaryBox string
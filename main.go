@@ -12,6 +12,7 @@ import (
 	"github.com/abdfnx/tran/cmd/tran"
 	"github.com/abdfnx/tran/cmd/factory"
 	"github.com/abdfnx/tran/app/checker"
+	"github.com/abdfnx/tran/pkg/tranclient"
 	"github.com/AlecAivazis/survey/v2/terminal"
 	surveyCore "github.com/AlecAivazis/survey/v2/core"
 )
@@ -24,11 +25,28 @@ var (
 type exitCode int
 
 const (
-	exitOK     exitCode = 0
-	exitError  exitCode = 1
-	exitCancel exitCode = 2
+	exitOK               exitCode = 0
+	exitError            exitCode = 1
+	exitCancel           exitCode = 2
+	exitAuth             exitCode = 3
+	exitTimeout          exitCode = 4
+	exitRelayUnreachable exitCode = 5
+	exitIntegrity        exitCode = 6
+	exitPeerAborted      exitCode = 7
+	exitDeclined         exitCode = 8
 )
 
+// transferExitCodes maps the kinds of failed transfers to exit codes.
+var transferExitCodes = map[tranclient.ErrorKind]exitCode{
+	tranclient.KindCancelled:        exitCancel,
+	tranclient.KindAuth:             exitAuth,
+	tranclient.KindTimeout:          exitTimeout,
+	tranclient.KindRelayUnreachable: exitRelayUnreachable,
+	tranclient.KindIntegrity:        exitIntegrity,
+	tranclient.KindPeerAborted:      exitPeerAborted,
+	tranclient.KindDeclined:         exitDeclined,
+}
+
 func main() {
 	code := mainRun()
 	os.Exit(int(code))
@@ -66,6 +84,8 @@ func mainRun() exitCode {
 	RootCmd := tran.Execute(cmdFactory, version, buildDate)
 
 	if cmd, err := RootCmd.ExecuteC(); err != nil {
+		var transferErr *tranclient.Error
+
 		if err == tools.SilentError {
 			return exitError
 		} else if tools.IsUserCancellation(err) {
@@ -74,6 +94,13 @@ func mainRun() exitCode {
 			}
 
 			return exitCancel
+		} else if errors.As(err, &transferErr) {
+			// the transfer UI has shown the error already
+			if code, ok := transferExitCodes[transferErr.Kind]; ok {
+				return code
+			}
+
+			return exitError
 		}
 
 		tools.PrintError(stderr, err, cmd, hasDebug)
@@ -1,11 +1,34 @@
 package models
 
-import "github.com/abdfnx/tran/ios"
+import (
+	"fmt"
+	"time"
+	"strconv"
+	"strings"
+
+	"github.com/abdfnx/tran/ios"
+	"github.com/abdfnx/tran/models/protocol"
+)
 
 type TranOptions struct {
 	TranxAddress string
 	TranxPort    int
+	Relays       []string // host:port of tranx servers to choose from by latency, instead of TranxAddress and TranxPort
 	Auth         AuthLogin
+	Timeouts     Timeouts
+	Direct       Direct
+	Password     PasswordOptions
+	Proxy        string // HTTP CONNECT or SOCKS5 proxy for connections to tranx, the one of the environment if empty
+	LAN          bool // find the peer on the local network instead of through tranx
+	LocalRelay   bool // serve an in-process tranx server instead of using the configured one
+	To           string // code of a receiver that requested the payload, the sender announces it with a new code if empty
+	MaxReceivers int // receivers the sender sends the payload to with the same code, one if zero
+	Expires      time.Duration // how long the code of the sender stays valid, the default of tranx if zero
+	Note         string // note the sender shows the receiver along with the manifest
+	Accept       AcceptRules // which payloads the receiver accepts without asking
+	Only         []string // glob patterns of the files the receiver requests, all files if empty
+	Streams      int // parallel connections of direct transfers, chosen by the measured throughput if zero
+	Compression  string // algorithm and level the sender compresses the payload with, like zstd:19, auto if empty
 }
 
 type AuthLogin struct {
@@ -15,3 +38,180 @@ type AuthLogin struct {
 }
 
 type Password string
+
+// PasswordOptions specifies the passwords generated by the sender.
+type PasswordOptions struct {
+	Words    int    `mapstructure:"words"`    // number of words, the default if zero
+	Wordlist string `mapstructure:"wordlist"` // name of the wordlist the words are chosen from, the default if empty
+	Phrase   string `mapstructure:"-"`        // words chosen by the sender instead of random ones, never read from the config
+}
+
+// Direct specifies how direct connections between the computers are accepted.
+type Direct struct {
+	Disabled bool   `mapstructure:"disabled"` // transfer through the relay only
+	Ports    string `mapstructure:"ports"`    // port or range of ports to listen on, like 9000-9010, any if empty
+	Bind     string `mapstructure:"bind"`     // address or interface to listen on, all if empty
+}
+
+// PortRange returns the first and last port of Ports, both are zero if any port may be used.
+func (d Direct) PortRange() (int, int, error) {
+	if d.Ports == "" {
+		return 0, 0, nil
+	}
+
+	first, last, isRange := strings.Cut(d.Ports, "-")
+	if !isRange {
+		last = first
+	}
+
+	firstPort, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q: %w", d.Ports, err)
+	}
+
+	lastPort, err := strconv.Atoi(strings.TrimSpace(last))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q: %w", d.Ports, err)
+	}
+
+	if firstPort < 1 || lastPort > 65535 || firstPort > lastPort {
+		return 0, 0, fmt.Errorf("invalid port range %q", d.Ports)
+	}
+
+	return firstPort, lastPort, nil
+}
+
+// AcceptRules specifies which payloads a receiver accepts without asking, it accepts none if All is false and no limit is set.
+type AcceptRules struct {
+	All      bool   `mapstructure:"-"`        // accept every payload, never read from the config
+	MaxSize  string `mapstructure:"max_size"` // largest uncompressed size to accept, like 500MB or 2GiB, no limit if empty
+	MaxFiles int    `mapstructure:"max_files"` // most files to accept, no limit if zero
+}
+
+// sizeUnits are the units MaxSize may end with, longest first so that suffixes match the right unit.
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+	{"B", 1},
+}
+
+// MaxBytes returns MaxSize in bytes, zero if it is empty.
+func (a AcceptRules) MaxBytes() (int64, error) {
+	size := strings.ToUpper(strings.TrimSpace(a.MaxSize))
+	if size == "" {
+		return 0, nil
+	}
+
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(size, u.suffix) {
+			size, unit = strings.TrimSpace(strings.TrimSuffix(size, u.suffix)), u.bytes
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(size, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size %q", a.MaxSize)
+	}
+
+	return int64(value * float64(unit)), nil
+}
+
+// Limited reports whether any limit is set, without one only All accepts payloads.
+func (a AcceptRules) Limited() bool {
+	return strings.TrimSpace(a.MaxSize) != "" || a.MaxFiles > 0
+}
+
+// Allows reports whether a payload of count files with a total size of size bytes is accepted without asking.
+func (a AcceptRules) Allows(count int, size int64) (bool, error) {
+	if a.All {
+		return true, nil
+	}
+
+	if !a.Limited() {
+		return false, nil
+	}
+
+	maxBytes, err := a.MaxBytes()
+	if err != nil {
+		return false, err
+	}
+
+	if maxBytes > 0 && size > maxBytes {
+		return false, nil
+	}
+
+	return a.MaxFiles <= 0 || count <= a.MaxFiles, nil
+}
+
+// Timeouts specifies how long each phase of a transfer may take.
+// A zero value selects the default of the phase, a negative value disables the timeout.
+type Timeouts struct {
+	Connect     time.Duration `mapstructure:"connect"`
+	Rendezvous  time.Duration `mapstructure:"rendezvous"`
+	KeyExchange time.Duration `mapstructure:"key_exchange"`
+	Handshake   time.Duration `mapstructure:"handshake"`
+	Prepare     time.Duration `mapstructure:"prepare"`
+	Review      time.Duration `mapstructure:"review"`
+	Transfer    time.Duration `mapstructure:"transfer"`
+	Close       time.Duration `mapstructure:"close"`
+}
+
+// DefaultTimeouts returns the timeouts used for phases that are not configured.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Connect:     15 * time.Second,
+		Rendezvous:  5 * time.Minute,
+		KeyExchange: 30 * time.Second,
+		Handshake:   30 * time.Second,
+		Prepare:     30 * time.Minute,
+		Review:      10 * time.Minute,
+		Transfer:    time.Minute,
+		Close:       15 * time.Second,
+	}
+}
+
+// Of returns the effective timeout of a phase, zero meaning no timeout.
+func (t Timeouts) Of(phase protocol.Phase) time.Duration {
+	defaults := DefaultTimeouts()
+	configured, fallback := t.Transfer, defaults.Transfer
+
+	switch phase {
+		case protocol.PhaseConnect:
+			configured, fallback = t.Connect, defaults.Connect
+
+		case protocol.PhaseRendezvous:
+			configured, fallback = t.Rendezvous, defaults.Rendezvous
+
+		case protocol.PhaseKeyExchange:
+			configured, fallback = t.KeyExchange, defaults.KeyExchange
+
+		case protocol.PhaseHandshake:
+			configured, fallback = t.Handshake, defaults.Handshake
+
+		case protocol.PhasePrepare:
+			configured, fallback = t.Prepare, defaults.Prepare
+
+		case protocol.PhaseReview:
+			configured, fallback = t.Review, defaults.Review
+
+		case protocol.PhaseClose:
+			configured, fallback = t.Close, defaults.Close
+	}
+
+	switch {
+		case configured < 0:
+			return 0
+
+		case configured == 0:
+			return fallback
+
+		default:
+			return configured
+	}
+}
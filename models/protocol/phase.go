@@ -0,0 +1,35 @@
+package protocol
+
+import (
+	"fmt"
+	"time"
+)
+
+// Phase names a step of the transfer, it is used to apply timeouts and to report where a transfer stalled.
+type Phase string
+
+const (
+	PhaseConnect     Phase = "connect"      // Dialing the tranx server or the other client
+	PhaseRendezvous  Phase = "rendezvous"   // Sender waits for a receiver to show up at the tranx server
+	PhaseKeyExchange Phase = "key-exchange" // PAKE2 key exchange and salt
+	PhaseHandshake   Phase = "handshake"    // Transfer handshake and choice between direct and relay communication
+	PhasePrepare     Phase = "prepare"      // Receiver waits for the sender to compress the payload
+	PhaseReview      Phase = "review"       // Sender waits for the receiver to review the manifest and request the payload
+	PhaseTransfer    Phase = "transfer"     // Payload transfer, the timeout applies to every single message
+	PhaseClose       Phase = "close"        // Closing sequence
+)
+
+// TimeoutError is returned when a phase of the transfer did not complete in time.
+type TimeoutError struct {
+	Phase Phase
+	Limit time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s during the %s phase", e.Limit, e.Phase)
+}
+
+// Timeout reports that this is a timeout, see net.Error.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
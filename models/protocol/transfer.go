@@ -3,7 +3,9 @@ package protocol
 import (
 	"fmt"
 	"net"
+	"errors"
 	"strings"
+	"encoding/json"
 )
 
 // TransferMessageType specifies the message type for the messages in the transfer protocol.
@@ -22,6 +24,14 @@ const (
 	ReceiverPayloadAck         // Receiver ACKs that is has received the payload
 	SenderClosing              // Sender announces that it is closing the connection
 	ReceiverClosingAck         // Receiver ACKs the closing of the connection
+	ReceiverReverseCommunication // Receiver could not reach the sender server and asks the sender to connect to it instead
+	SenderReverseAck             // Sender has connected to the receiver, sent over both connections
+	SenderReverseFailed          // Sender could not connect to the receiver, relay communication will be used
+	SenderPayloadSelected        // Sender announces the size of the payload of the files the receiver selected
+	SenderSegment                // Sender announces the range of the payload that follows on the stream
+	ReceiverStream               // Receiver opens a further stream to the sender server
+	SenderStreamDone             // Sender has sent all segments it sends on the stream
+	ReceiverPayloadProgress      // Receiver acknowledges the bytes of the payload received so far
 )
 
 // TransferMessage specifies a message in the transfer protocol.
@@ -34,15 +44,174 @@ func (t TransferMessage) Bytes() []byte {
 	return []byte(fmt.Sprintf("%v", t))
 }
 
+// TransferErrorCode specifies why a transfer was aborted.
+type TransferErrorCode int
+
+const (
+	ErrorUnknown        TransferErrorCode = iota // The reason is not known
+	ErrorCancelled                               // The user cancelled the transfer
+	ErrorUnsynchronized                          // The clients disagree about the state of the transfer
+	ErrorTimeout                                 // A phase of the transfer timed out
+	ErrorDiskFull                                // There is no space left to store the payload
+	ErrorVerification                            // A message failed the integrity verification
+	ErrorDeclined                                // The receiver declined the payload after reviewing its manifest
+)
+
+// ErrDeclined is returned when the receiver declines the payload.
+var ErrDeclined = errors.New("the receiver declined the files")
+
+// TransferErrorPayload specifies the payload of a TransferError message.
+type TransferErrorPayload struct {
+	Code    TransferErrorCode `json:"code"`
+	Message string            `json:"message"`
+}
+
+// PeerError is returned when the other client aborted the transfer with a TransferError message.
+type PeerError struct {
+	Code    TransferErrorCode
+	Message string
+}
+
+// NewPeerError returns the PeerError described by the payload of a TransferError message.
+func NewPeerError(payload interface{}) *PeerError {
+	// older clients send the message as the whole payload
+	if message, ok := payload.(string); ok {
+		return &PeerError{Code: ErrorUnknown, Message: message}
+	}
+
+	errorPayload := TransferErrorPayload{}
+	bytes, _ := json.Marshal(payload)
+
+	if err := json.Unmarshal(bytes, &errorPayload); err != nil || errorPayload.Message == "" {
+		errorPayload.Message = "no reason given"
+	}
+
+	return &PeerError{Code: errorPayload.Code, Message: errorPayload.Message}
+}
+
+func (e *PeerError) Error() string {
+	return fmt.Sprintf("the other side aborted the transfer: %s", e.Message)
+}
+
+// ReceiverHandshakePayload specifies a payload type for announcing the addresses of the receiver,
+// IP is the address of its tranx connection and Candidates lists all addresses it may be reached at.
+// Compressions lists the compression algorithms the receiver decompresses, receivers of older versions only decompress gzip.
 type ReceiverHandshakePayload struct {
-	IP net.IP `json:"ip"`
+	IP           net.IP   `json:"ip"`
+	Candidates   []net.IP `json:"candidates,omitempty"`
+	Compressions []string `json:"compressions,omitempty"`
+}
+
+// Decompresses reports whether the receiver decompresses the payload compressed with algorithm.
+func (p ReceiverHandshakePayload) Decompresses(algorithm string) bool {
+	if len(p.Compressions) == 0 {
+		return algorithm == CompressionGzip
+	}
+
+	for _, compression := range p.Compressions {
+		if compression == algorithm {
+			return true
+		}
+	}
+
+	return false
 }
 
-// SenderHandshakePayload specifies a payload type for announcing the payload size.
+// Compression algorithms of the payload, auto is resolved by the sender before the handshake.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+	CompressionNone = "none"
+	CompressionAuto = "auto"
+)
+
+// Compressions lists the compression algorithms a payload may be compressed with.
+var Compressions = []string{CompressionGzip, CompressionZstd, CompressionNone}
+
+// Compression specifies how the payload is compressed, a Level of zero is the default level of the algorithm.
+type Compression struct {
+	Algorithm string `json:"algorithm"`
+	Level     int    `json:"level,omitempty"`
+}
+
+// SenderHandshakePayload specifies a payload type for announcing the payload size and the addresses of the sender server.
+// Token authenticates the one connection to the sender server,
+// Reverse is set if the sender connects to the receiver when the receiver can not reach its server.
+// Streams is the number of parallel streams the sender server accepts, senders of older versions send the payload in one piece.
+// Window is set if the sender takes acknowledgements of the received bytes, it sends at most that many bytes ahead of them.
+// Compression tells how the payload is compressed, senders of older versions send none and compress it with gzip.
 type SenderHandshakePayload struct {
-	IP          net.IP `json:"ip"`
-	Port        int    `json:"port"`
-	PayloadSize int64  `json:"payload_size"`
+	IP          net.IP   `json:"ip"`
+	Candidates  []net.IP `json:"candidates,omitempty"`
+	Port        int      `json:"port"`
+	Token       string   `json:"token,omitempty"`
+	PayloadSize int64    `json:"payload_size"`
+	Reverse     bool     `json:"reverse,omitempty"`
+	Manifest    *Manifest `json:"manifest,omitempty"`
+	Streams     int      `json:"streams,omitempty"`
+	Window      int64    `json:"window,omitempty"`
+	Compression *Compression `json:"compression,omitempty"`
+}
+
+// Manifest describes the payload to the receiver before it requests the payload, older senders send none.
+// Files lists at most MaxManifestFiles of the Count files, Size is their total uncompressed size.
+type Manifest struct {
+	Files []ManifestFile `json:"files"`
+	Count int            `json:"count"`
+	Size  int64          `json:"size"`
+	Note  string         `json:"note,omitempty"`
+}
+
+// ManifestFile is a file of the payload, Path is its name in the archive.
+type ManifestFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// MaxManifestFiles bounds the files a manifest lists, to keep the handshake small.
+const MaxManifestFiles = 10000
+
+// Truncated reports whether the manifest lists fewer files than the payload holds.
+func (m *Manifest) Truncated() bool {
+	return len(m.Files) < m.Count
+}
+
+// RequestPayload specifies the payload of a ReceiverRequestPayload message, the glob patterns of the files
+// the receiver selected. Senders of older versions send every file, the receiver has to skip the others.
+// Streams is set if the payload is to be sent in segments, the receiver opens up to that many streams.
+// Acks is set if the receiver acknowledges the received bytes at least every quarter of the window of the sender.
+type RequestPayload struct {
+	Only    []string `json:"only,omitempty"`
+	Streams int      `json:"streams,omitempty"`
+	Acks    bool     `json:"acks,omitempty"`
+}
+
+// SegmentPayload specifies the payload of a SenderSegment message, the range of the payload that follows.
+type SegmentPayload struct {
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+}
+
+// StreamPayload specifies the payload of a ReceiverStream message, the number of the stream counting from one,
+// the connection the payload was requested over is stream zero.
+type StreamPayload struct {
+	Stream int `json:"stream"`
+}
+
+// ProgressPayload specifies the payload of a ReceiverPayloadProgress message, the bytes of the payload received so far.
+type ProgressPayload struct {
+	Bytes int64 `json:"bytes"`
+}
+
+// SelectedPayload specifies the payload of a SenderPayloadSelected message, sent before the payload of the selected files.
+type SelectedPayload struct {
+	PayloadSize int64 `json:"payload_size"`
+}
+
+// ReceiverReversePayload specifies a payload type for announcing the server the sender should connect to.
+type ReceiverReversePayload struct {
+	Candidates []net.IP `json:"candidates"`
+	Port       int      `json:"port"`
 }
 
 type WrongMessageTypeError struct {
@@ -101,6 +270,30 @@ func (t TransferMessageType) Name() string {
 		case ReceiverClosingAck:
 			return "ReceiverClosingAck"
 
+		case ReceiverReverseCommunication:
+			return "ReceiverReverseCommunication"
+
+		case SenderReverseAck:
+			return "SenderReverseAck"
+
+		case SenderReverseFailed:
+			return "SenderReverseFailed"
+
+		case SenderPayloadSelected:
+			return "SenderPayloadSelected"
+
+		case SenderSegment:
+			return "SenderSegment"
+
+		case ReceiverStream:
+			return "ReceiverStream"
+
+		case SenderStreamDone:
+			return "SenderStreamDone"
+
+		case ReceiverPayloadProgress:
+			return "ReceiverPayloadProgress"
+
 		default:
 			return ""
 	}
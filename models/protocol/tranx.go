@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"fmt"
 	"net"
 
 	"github.com/gorilla/websocket"
@@ -21,6 +22,9 @@ const (
 	TranxToReceiverSalt      // Rendevoux forwards cryptographic salt to receiver
 	ReceiverToTranxClose     // Receiver can connect directly to sender, close receiver connection -> close sender connection
 	SenderToTranxClose       // Transit sequence is completed, close sender connection -> close receiver connection
+	TranxToClientError       // Tranx rejects the request of a client and closes the connection
+	TranxToReceiverReady     // Tranx announces to a receiver that requested the payload that the sender is connected
+	TranxToSenderBroadcast   // Tranx tells the sender that announced a broadcast the secret its further connections present
 )
 
 type TranxMessage struct {
@@ -43,7 +47,10 @@ type TranxReceiver = TranxClient
 /* [💻 Receiver <-> Sender 💻] messages */
 
 type PasswordPayload struct {
-	Password string `json:"password"`
+	Password  string `json:"password"`
+	Receivers int    `json:"receivers,omitempty"` // receivers the sender sends to, one if zero
+	Expires   int    `json:"expires,omitempty"`   // seconds the password is valid for, the default of tranx if zero
+	Secret    string `json:"secret,omitempty"`    // the secret of the broadcast a further connection of its sender joins
 }
 type PakePayload struct {
 	Bytes []byte `json:"pake_bytes"`
@@ -58,3 +65,49 @@ type SaltPayload struct {
 type TranxToSenderBindPayload struct {
 	ID int `json:"id"`
 }
+
+type TranxToSenderBroadcastPayload struct {
+	Secret string `json:"secret"`
+}
+
+/* [Tranx -> Client] messages */
+
+// TranxErrorCode specifies why tranx rejected a request.
+type TranxErrorCode int
+
+const (
+	TranxErrorUnknownCode TranxErrorCode = iota // No sender waits with the password
+	TranxErrorCodeInUse                         // Another receiver already uses the password
+	TranxErrorWrongDirection                    // The password belongs to a session that transfers the other way
+	TranxErrorCodeUsed                          // A receiver used the password already, passwords work only once
+	TranxErrorCodeExpired                       // The password expired before a receiver used it
+)
+
+type TranxErrorPayload struct {
+	Code    TranxErrorCode `json:"code"`
+	Message string         `json:"message"`
+}
+
+// TranxError is returned when tranx rejects a request with a TranxToClientError message.
+type TranxError struct {
+	Code    TranxErrorCode
+	Message string
+}
+
+func (e *TranxError) Error() string {
+	return fmt.Sprintf("tranx rejected the request: %s", e.Message)
+}
+
+// UnreachableError is returned when the tranx server can not be reached.
+type UnreachableError struct {
+	Address string
+	Err     error
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("could not reach the tranx server at %s: %s", e.Address, e.Err)
+}
+
+func (e *UnreachableError) Unwrap() error {
+	return e.Err
+}
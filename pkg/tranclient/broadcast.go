@@ -0,0 +1,151 @@
+package tranclient
+
+import (
+	"os"
+	"fmt"
+	"context"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/models"
+	"github.com/abdfnx/tran/core/sender"
+)
+
+// broadcastResult is the outcome of the sender connection serving a receiver of a broadcast.
+type broadcastResult struct {
+	receiver int
+	err      error
+}
+
+// broadcast sends the payload to every receiver that joins, until opts.MaxReceivers have joined or no further receiver joins.
+// Every receiver is served by a sender connection of its own, with its own key exchange and key:
+// the first one is the connection of senderClient, the next one is connected once the previous one was joined.
+// The session fails with the first error of a receiver that joined, the error of a connection
+// that was never joined only counts if no receiver joined at all.
+func (s *Session) broadcast(ctx context.Context, opts Options, senderClient *sender.Sender, password models.Password,
+	startServerCh <-chan sender.ServerOptions, relayCh <-chan *websocket.Conn, errCh <-chan error, joinedCh chan bool,
+	prepareErrCh <-chan error, readyCh <-chan bool, prepared *payloadFile, payloadCh <-chan *os.File) {
+	results := make(chan broadcastResult)
+	joined, running := 0, 1
+
+	go func() {
+		results <- broadcastResult{receiver: 1, err: s.transfer(ctx, opts, senderClient, startServerCh, relayCh, errCh)}
+	}()
+
+	// join counts the receiver that joined and connects the sender for the next one
+	join := func() {
+		joined++
+		if joined == opts.MaxReceivers || ctx.Err() != nil {
+			return
+		}
+
+		running++
+		receiver := joined + 1
+
+		go func() {
+			err := s.sendToNext(ctx, opts, receiver, password, senderClient.BroadcastSecret(), senderClient.TranxAddress(),
+				senderClient.TranxPort(), joinedCh, readyCh, prepared)
+			results <- broadcastResult{receiver: receiver, err: err}
+		}()
+	}
+
+	var err error
+
+	for running > 0 {
+		select {
+			case <-joinedCh:
+				join()
+
+			case result := <-results:
+				running--
+
+				// a connection signals its receiver before it ends
+				for len(joinedCh) > 0 {
+					<-joinedCh
+					join()
+				}
+
+				switch {
+					case result.receiver > joined:
+						// no further receiver joins, unless none joined the receivers got the payload
+						if joined == 0 {
+							err = result.err
+						}
+
+					case result.err != nil && err == nil:
+						err = result.err
+				}
+
+			case prepareErr := <-prepareErrCh:
+				err = prepareErr
+				s.cancel()
+		}
+	}
+
+	s.finish(opts, err, payloadCh)
+}
+
+// sendToNext connects another sender to the broadcast with password and secret at the tranx server of the first one
+// and transfers the payload to the receiver that joins it, reading the prepared payload on its own.
+func (s *Session) sendToNext(ctx context.Context, opts Options, receiver int, password models.Password, secret string,
+	tranxAddress string, tranxPort int, joinedCh chan<- bool, readyCh <-chan bool, prepared *payloadFile) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	uiCh := make(chan sender.UIUpdate)
+	senderClient := sender.WithUI(sender.NewSender(opts.TranOptions), uiCh)
+	sender.WithSelection(senderClient, s.selectFiles)
+	sender.WithBroadcast(senderClient, password, secret, opts.MaxReceivers, joinedCh)
+
+	go forwardSenderUpdates(opts, uiCh, receiver, s.done)
+
+	errCh := make(chan error, 2)
+	payloadReady := make(chan bool)
+	opened := make(chan *os.File, 1)
+
+	go func() {
+		defer close(opened)
+
+		select {
+			case <-readyCh:
+
+			case <-ctx.Done():
+				return
+		}
+
+		payload, err := os.Open(prepared.name)
+		if err != nil {
+			errCh <- fmt.Errorf("error opening the payload: %w", err)
+			return
+		}
+
+		opened <- payload
+		sender.WithManifest(sender.WithPayload(senderClient, payload, prepared.size), prepared.manifest)
+		sender.WithCompression(senderClient, prepared.compression)
+		close(payloadReady)
+	}()
+
+	startServerCh := make(chan sender.ServerOptions, 1)
+	relayCh := make(chan *websocket.Conn, 1)
+
+	// without a server the transfer is relayed through tranx
+	if opts.Direct.Disabled {
+		startServerCh = nil
+	}
+
+	go func() {
+		err := senderClient.ConnectToTranx(ctx, tranxAddress, tranxPort, nil, startServerCh, payloadReady, relayCh)
+		if err != nil {
+			errCh <- newError(fmt.Errorf("failed to communicate with tranx server: %w", err), true)
+		}
+	}()
+
+	err := s.transfer(ctx, opts, senderClient, startServerCh, relayCh, errCh)
+
+	// the payload is closed once it can no longer be opened
+	cancel()
+	if payload := <-opened; payload != nil {
+		payload.Close()
+	}
+
+	return err
+}
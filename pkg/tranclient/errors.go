@@ -0,0 +1,122 @@
+package tranclient
+
+import (
+	"errors"
+	"context"
+
+	"github.com/abdfnx/tran/core/crypt"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// ErrorKind classifies why a transfer failed.
+type ErrorKind int
+
+const (
+	KindUnknown          ErrorKind = iota // The cause is not classified
+	KindCancelled                         // The transfer was cancelled on this side
+	KindAuth                              // The code is malformed or was not accepted
+	KindTimeout                           // The peer or the tranx server did not answer in time
+	KindRelayUnreachable                  // The tranx server could not be reached
+	KindIntegrity                         // The payload failed the integrity verification
+	KindPeerAborted                       // The peer aborted the transfer
+	KindDeclined                          // The receiver declined the payload after reviewing its manifest
+)
+
+// Error is returned by Send, Receive and Session.Wait, it classifies the cause of a failed transfer.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of a failed transfer, KindUnknown if err is not an *Error.
+func KindOf(err error) ErrorKind {
+	var tranErr *Error
+	if errors.As(err, &tranErr) {
+		return tranErr.Kind
+	}
+
+	return KindUnknown
+}
+
+// newError classifies err unless it is classified already,
+// negotiating reports whether err occurred before the payload transfer started.
+func newError(err error, negotiating bool) error {
+	var tranErr *Error
+	if err == nil || errors.As(err, &tranErr) {
+		return err
+	}
+
+	return &Error{Kind: kindOf(err, negotiating), Err: err}
+}
+
+func kindOf(err error, negotiating bool) ErrorKind {
+	var peerErr *protocol.PeerError
+	var tranxErr *protocol.TranxError
+	var timeoutErr *protocol.TimeoutError
+	var unreachableErr *protocol.UnreachableError
+
+	// a key that does not match during the negotiation means the peers used different codes
+	verificationKind := KindIntegrity
+	if negotiating {
+		verificationKind = KindAuth
+	}
+
+	switch {
+		case errors.Is(err, context.Canceled):
+			return KindCancelled
+
+		case errors.Is(err, protocol.ErrDeclined):
+			return KindDeclined
+
+		case errors.As(err, &unreachableErr):
+			return KindRelayUnreachable
+
+		case errors.As(err, &tranxErr):
+			return KindAuth
+
+		case errors.As(err, &timeoutErr) || errors.Is(err, context.DeadlineExceeded):
+			return KindTimeout
+
+		case errors.Is(err, crypt.ErrVerification):
+			return verificationKind
+
+		case errors.As(err, &peerErr):
+			switch peerErr.Code {
+				case protocol.ErrorTimeout:
+					return KindTimeout
+
+				case protocol.ErrorVerification:
+					return verificationKind
+
+				case protocol.ErrorDeclined:
+					return KindDeclined
+			}
+
+			return KindPeerAborted
+	}
+
+	return KindUnknown
+}
+
+// isUnreachable reports whether err is caused by a tranx server that could not be reached.
+func isUnreachable(err error) bool {
+	var unreachableErr *protocol.UnreachableError
+
+	return errors.As(err, &unreachableErr)
+}
+
+// isUnknownOrUnreachable reports whether err is caused by a tranx server that could not be reached
+// or that has no sender waiting with the password.
+func isUnknownOrUnreachable(err error) bool {
+	var tranxErr *protocol.TranxError
+
+	return isUnreachable(err) || (errors.As(err, &tranxErr) && tranxErr.Code == protocol.TranxErrorUnknownCode)
+}
@@ -0,0 +1,115 @@
+package tranclient
+
+import (
+	"os"
+	"net"
+	"fmt"
+	"time"
+	"context"
+	"testing"
+	"path/filepath"
+
+	"github.com/schollz/pake/v3"
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models"
+	"github.com/abdfnx/tran/core/crypt"
+	"github.com/abdfnx/tran/core/discovery"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// impersonate connects to the sender at addr and runs the key exchange with the wrong password,
+// it returns once the sender dropped the connection.
+func impersonate(t *testing.T, addr *net.TCPAddr) {
+	wsConn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/establish-receiver", addr), nil)
+	if err != nil {
+		t.Fatalf("the impostor could not connect: %v", err)
+	}
+
+	defer wsConn.Close()
+
+	wsConn.WriteJSON(protocol.TranxMessage{Type: protocol.ReceiverToTranxEstablish, Payload: protocol.PasswordPayload{}})
+
+	msg, err := tools.ReadTranxMessage(wsConn, protocol.TranxToReceiverPAKE)
+	if err != nil {
+		t.Fatalf("the sender did not start the key exchange with the impostor: %v", err)
+	}
+
+	pakePayload := protocol.PakePayload{}
+	tools.DecodePayload(msg.Payload, &pakePayload)
+
+	p, _ := pake.InitCurve([]byte("1-wrong-guess-here"), 1, "p256")
+	p.Update(pakePayload.Bytes)
+	wsConn.WriteJSON(protocol.TranxMessage{Type: protocol.ReceiverToTranxPAKE, Payload: protocol.PakePayload{Bytes: p.Bytes()}})
+
+	msg, err = tools.ReadTranxMessage(wsConn, protocol.TranxToReceiverSalt)
+	if err != nil {
+		t.Fatalf("the sender did not send the salt: %v", err)
+	}
+
+	saltPayload := protocol.SaltPayload{}
+	tools.DecodePayload(msg.Payload, &saltPayload)
+
+	key, _ := p.SessionKey()
+	c, _ := crypt.New(key, saltPayload.Salt)
+	tools.WriteEncryptedMessage(wsConn, protocol.TransferMessage{Type: protocol.ReceiverHandshake, Payload: protocol.ReceiverHandshakePayload{}}, c)
+
+	// the sender can not decrypt the handshake and drops the impostor
+	if _, _, err := wsConn.ReadMessage(); err == nil {
+		t.Error("the sender answered the impostor")
+	}
+}
+
+func TestLANSenderWaitsForTheReceiverThatKnowsThePassword(t *testing.T) {
+	group, err := net.ResolveUDPAddr("udp4", discovery.GroupAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conn, err := net.ListenMulticastUDP("udp4", nil, group); err != nil {
+		t.Skipf("multicast is not available: %v", err)
+	} else {
+		conn.Close()
+	}
+
+	src, dst := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "b.txt"), []byte("hello lan"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// the tranx server is unreachable on purpose
+	opts := Options{TranOptions: models.TranOptions{TranxAddress: "127.0.0.1", TranxPort: 1, LAN: true}}
+
+	session, err := Send(ctx, opts, []string{filepath.Join(src, "b.txt")})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	addr, err := discovery.Lookup(ctx, discovery.ID(session.Code()))
+	if err != nil {
+		t.Fatalf("the sender was not announced: %v", err)
+	}
+
+	impersonate(t, addr)
+
+	result, err := Receive(ctx, opts, string(session.Code()), DirSink(dst))
+	if err != nil {
+		t.Fatalf("Receive after the impostor: %v", err)
+	}
+
+	if err := session.Wait(); err != nil {
+		t.Fatalf("Send after the impostor: %v", err)
+	}
+
+	if len(result.Files) != 1 {
+		t.Fatalf("received %v, want b.txt", result.Files)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dst, result.Files[0]))
+	if err != nil || string(data) != "hello lan" {
+		t.Errorf("received %q, %v, want hello lan", data, err)
+	}
+}
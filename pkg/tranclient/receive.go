@@ -0,0 +1,178 @@
+package tranclient
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"context"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/constants"
+	"github.com/abdfnx/tran/core/receiver"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// Result describes the files expanded by Receive.
+type Result struct {
+	Files []string
+	Size  int64
+}
+
+// Receive receives the payload announced with code and expands it into sink.
+// Typos in the words of code are corrected, see tools.CorrectCode.
+func Receive(ctx context.Context, opts Options, code string, sink Sink) (*Result, error) {
+	password, host, port, err := tools.ParseCode(tools.CorrectCode(code))
+	if err != nil {
+		return nil, &Error{Kind: KindAuth, Err: fmt.Errorf("error parsing password, make sure you entered a correctly formatted password (e.g. 1-gamma-ray-quasar): %w", err)}
+	}
+
+	// the code names the tranx server of the sender
+	if host != "" {
+		opts.TranxAddress, opts.TranxPort = host, port
+		opts.Relays = nil
+	}
+
+	// communicate ui updates on this channel between receiverClient and the event handler
+	uiCh := make(chan receiver.UIUpdate)
+	receiverClient := receiver.WithUI(receiver.NewReceiver(opts.TranOptions), uiCh)
+	done := make(chan struct{})
+	defer close(done)
+	go forwardReceiverUpdates(opts, uiCh, done)
+
+	var wsConn *websocket.Conn
+
+	if opts.LAN {
+		wsConn, err = receiverClient.ConnectLAN(ctx, password)
+	} else {
+		// without the tranx server in the code, the sender may be waiting on any of them
+		err = tryRelays(relayAddresses(opts), isUnknownOrUnreachable, func(host string, port int) error {
+			wsConn, err = receiverClient.ConnectToTranx(ctx, host, port, password)
+
+			return err
+		})
+	}
+
+	if err != nil {
+		return nil, newError(fmt.Errorf("something went wrong during connection-negotiation (did you enter the correct password?): %w", err), true)
+	}
+
+	return receivePayload(ctx, opts, receiverClient, wsConn, sink)
+}
+
+// receivePayload receives the payload over wsConn and expands it into sink.
+func receivePayload(ctx context.Context, opts Options, receiverClient *receiver.Receiver, wsConn *websocket.Conn, sink Sink) (*Result, error) {
+	defer wsConn.Close()
+
+	opts.emit(Event{Type: EventFileInfo, Bytes: receiverClient.PayloadSize()})
+
+	only := opts.Only
+	if err := tools.ValidatePatterns(only); err != nil {
+		receiverClient.Decline(wsConn)
+		return nil, newError(fmt.Errorf("invalid selection of files: %w", err), false)
+	}
+
+	manifest := receiverClient.Manifest()
+	sent := manifest
+	if manifest == nil {
+		manifest = &Manifest{Size: receiverClient.PayloadSize()}
+	} else if len(only) > 0 {
+		manifest = selectManifest(manifest, only)
+
+		if manifest.Count == 0 {
+			receiverClient.Decline(wsConn)
+			return nil, newError(fmt.Errorf("none of the files matches the selection %q", only), false)
+		}
+	}
+
+	// the payload is requested only once its manifest was accepted
+	if opts.Review != nil {
+		var decision Decision
+		err := receiverClient.Review(ctx, wsConn, func(ctx context.Context) bool {
+			decision = opts.Review(ctx, manifest)
+
+			return decision.Accept
+		})
+
+		if err != nil {
+			return nil, newError(fmt.Errorf("the payload was not received: %w", err), false)
+		}
+
+		// the files picked in the review are requested by their exact paths
+		if len(decision.Only) > 0 {
+			only = nil
+			for _, path := range decision.Only {
+				only = append(only, tools.QuoteGlob(path))
+			}
+		}
+	}
+
+	receiver.WithSelection(receiverClient, only)
+
+	tempFile, err := os.CreateTemp(os.TempDir(), constants.RECEIVE_TEMP_FILE_NAME_PREFIX)
+	if err != nil {
+		return nil, newError(fmt.Errorf("something went wrong when creating the received file container: %w", err), false)
+	}
+
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	// start receiving files from sender
+	if err = receiverClient.Receive(ctx, wsConn, tempFile); err != nil {
+		return nil, newError(fmt.Errorf("something went wrong during file transfer: %w", err), false)
+	}
+
+	if receiverClient.UsedRelay() {
+		wsConn.WriteJSON(protocol.TranxMessage{Type: protocol.ReceiverToTranxClose})
+	}
+
+	// reset file position for reading
+	tempFile.Seek(0, io.SeekStart)
+
+	// read received bytes from tmpFile
+	// the payload may not hold more than the manifest the sender announced
+	receivedFileNames, decompressedSize, err := tools.DecompressAndUnarchiveBytes(tempFile, sink, only, receiverClient.Compression(), sent)
+	if err != nil {
+		return nil, newError(fmt.Errorf("something went wrong when expanding the received files: %w", err), false)
+	}
+
+	opts.emit(Event{Type: EventFinished, Files: receivedFileNames, Bytes: decompressedSize})
+
+	return &Result{Files: receivedFileNames, Size: decompressedSize}, nil
+}
+
+// selectManifest returns the manifest of the files matching the patterns of only. The count and size of a truncated manifest
+// stay those of all files, the files it does not list may match as well.
+func selectManifest(manifest *Manifest, only []string) *Manifest {
+	selected := &Manifest{Count: manifest.Count, Size: manifest.Size, Note: manifest.Note}
+
+	var count int
+	var size int64
+
+	for _, file := range manifest.Files {
+		if tools.MatchesAny(file.Path, only) {
+			selected.Files = append(selected.Files, file)
+			count++
+			size += file.Size
+		}
+	}
+
+	if !manifest.Truncated() {
+		selected.Count, selected.Size = count, size
+	}
+
+	return selected
+}
+
+// forwardReceiverUpdates reports the updates of the receiverClient as events until done is closed.
+func forwardReceiverUpdates(opts Options, uiCh <-chan receiver.UIUpdate, done <-chan struct{}) {
+	for {
+		select {
+			case update := <-uiCh:
+				opts.emit(Event{Type: EventProgress, Progress: update.Progress})
+
+			case <-done:
+				return
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package tranclient
+
+import (
+	"io"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+	"context"
+	"strconv"
+	"net/http"
+
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models"
+	"github.com/abdfnx/tran/core/tranx"
+)
+
+// relayProbeTimeout bounds the health check of a tranx server.
+const relayProbeTimeout = 2 * time.Second
+
+// startLocalRelay serves an in-process tranx server on the address and ports the policy allows for direct connections,
+// and returns it with the address it listens on.
+func startLocalRelay(policy models.Direct) (*tranx.Server, *net.TCPAddr, error) {
+	listener, err := tools.ListenDirect(policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// keep the relay quiet, the UI owns the terminal
+	relay := tranx.WithLogger(tranx.NewServer(0), log.New(io.Discard, "", 0))
+	go relay.Serve(listener)
+
+	return relay, listener.Addr().(*net.TCPAddr), nil
+}
+
+// relayAddresses returns the host:port of the tranx servers to connect to, in the order they are configured.
+func relayAddresses(opts Options) []string {
+	if len(opts.Relays) > 0 {
+		return opts.Relays
+	}
+
+	return []string{net.JoinHostPort(opts.TranxAddress, strconv.Itoa(opts.TranxPort))}
+}
+
+// rankRelays probes the health of the tranx servers concurrently and orders them by latency,
+// the ones that did not answer go last in their configured order, so they are still tried if all others fail.
+func rankRelays(ctx context.Context, relays []string, proxy string) []string {
+	if len(relays) < 2 {
+		return relays
+	}
+
+	transport := &http.Transport{Proxy: tools.ProxyFunc(proxy)}
+	defer transport.CloseIdleConnections()
+
+	client := &http.Client{Transport: transport, Timeout: relayProbeTimeout}
+	latencies := make([]time.Duration, len(relays))
+
+	var wg sync.WaitGroup
+
+	for i, relay := range relays {
+		wg.Add(1)
+
+		go func(i int, relay string) {
+			defer wg.Done()
+
+			latencies[i] = probeRelay(ctx, client, relay)
+		}(i, relay)
+	}
+
+	wg.Wait()
+
+	ranked := make([]int, len(relays))
+	for i := range ranked {
+		ranked[i] = i
+	}
+
+	sort.SliceStable(ranked, func(a, b int) bool {
+		latencyA, latencyB := latencies[ranked[a]], latencies[ranked[b]]
+
+		return latencyA >= 0 && (latencyB < 0 || latencyA < latencyB)
+	})
+
+	ordered := make([]string, len(relays))
+	for i, index := range ranked {
+		ordered[i] = relays[index]
+	}
+
+	return ordered
+}
+
+// probeRelay returns the time the tranx server at relay took to answer its health check, or -1 if it is not healthy.
+func probeRelay(ctx context.Context, client *http.Client, relay string) time.Duration {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/health", relay), nil)
+	if err != nil {
+		return -1
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return -1
+	}
+
+	resp.Body.Close()
+
+	// older tranx servers do not know the health check, answering at all shows they are up
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return -1
+	}
+
+	return time.Since(start)
+}
+
+// tryRelays calls connect with the tranx servers in order until it succeeds,
+// the next one is only tried if retry reports that err may not occur with it.
+func tryRelays(relays []string, retry func(err error) bool, connect func(host string, port int) error) error {
+	var err error
+
+	for i, relay := range relays {
+		host, port, parseErr := tools.ParseRelay(relay)
+		if parseErr != nil {
+			return fmt.Errorf("invalid tranx server: %w", parseErr)
+		}
+
+		err = connect(host, port)
+		if err == nil || i == len(relays)-1 || !retry(err) {
+			return err
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,37 @@
+package tranclient
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/abdfnx/tran/models"
+)
+
+func TestLocalRelayFollowsTheDirectPolicy(t *testing.T) {
+	// a port that is free right now
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	relay, addr, err := startLocalRelay(models.Direct{Bind: "127.0.0.1", Ports: strconv.Itoa(port)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := &Session{relay: relay}
+	defer session.stopRelay()
+
+	if !addr.IP.Equal(net.IPv4(127, 0, 0, 1)) || addr.Port != port {
+		t.Errorf("the relay listens on %s, want 127.0.0.1:%d", addr, port)
+	}
+
+	// the port is taken by the relay, none of the range is left
+	if _, _, err := startLocalRelay(models.Direct{Bind: "127.0.0.1", Ports: strconv.Itoa(port)}); err == nil {
+		t.Error("a second relay listens on the port of the first one")
+	}
+}
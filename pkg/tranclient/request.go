@@ -0,0 +1,135 @@
+package tranclient
+
+import (
+	"fmt"
+	"context"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models"
+	"github.com/abdfnx/tran/core/receiver"
+)
+
+// RequestSession is a running request for a payload, it ends once the payload is received, an error occurred or it was closed.
+type RequestSession struct {
+	code   string
+	link   string
+	cancel context.CancelFunc
+	done   chan struct{}
+	result *Result
+	err    error
+}
+
+// Code returns the code the sender needs to send the payload with, see Options.To.
+func (s *RequestSession) Code() string {
+	return s.code
+}
+
+// Link returns the tran:// link naming the tranx server and the password, which Options.To accepts as the code.
+func (s *RequestSession) Link() string {
+	return s.link
+}
+
+// Done returns a channel that is closed when the session has ended.
+func (s *RequestSession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Wait blocks until the session has ended and returns the received files or its error.
+func (s *RequestSession) Wait() (*Result, error) {
+	<-s.done
+
+	return s.result, s.err
+}
+
+// Close aborts the session and waits for it to clean up.
+func (s *RequestSession) Close() error {
+	s.cancel()
+	_, err := s.Wait()
+
+	return err
+}
+
+// Request allocates a code on the tranx server and waits for a sender to send its payload with it,
+// which is expanded into sink.
+// It returns as soon as the code is known, the transfer itself continues in the returned RequestSession.
+func Request(ctx context.Context, opts Options, sink Sink) (*RequestSession, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	session := &RequestSession{cancel: cancel, done: make(chan struct{})}
+
+	// communicate ui updates on this channel between receiverClient and the event handler
+	uiCh := make(chan receiver.UIUpdate)
+	receiverClient := receiver.WithUI(receiver.NewReceiver(opts.TranOptions), uiCh)
+	go forwardReceiverUpdates(opts, uiCh, session.done)
+
+	passCh := make(chan models.Password, 1)
+	connCh := make(chan *websocket.Conn, 1)
+	errCh := make(chan error, 1)
+
+	// request on the fastest tranx server that is reachable
+	go func() {
+		var wsConn *websocket.Conn
+
+		relays := rankRelays(ctx, relayAddresses(opts), opts.Proxy)
+		err := tryRelays(relays, isUnreachable, func(host string, port int) error {
+			var err error
+			wsConn, err = receiverClient.RequestFromTranx(ctx, host, port, passCh)
+
+			return err
+		})
+
+		if err != nil {
+			errCh <- newError(fmt.Errorf("something went wrong during connection-negotiation: %w", err), true)
+
+			return
+		}
+
+		connCh <- wsConn
+	}()
+
+	select {
+		case password := <-passCh:
+			session.code = string(password)
+			session.link = tools.ShareLink(password, receiverClient.TranxAddress(), receiverClient.TranxPort())
+
+			// the sender has to connect to the same tranx server
+			if len(opts.Relays) > 0 {
+				session.code = tools.RelayCode(password, receiverClient.TranxAddress(), receiverClient.TranxPort())
+			}
+
+		case err := <-errCh:
+			session.finish(nil, err)
+			return nil, session.err
+
+		case <-ctx.Done():
+			session.finish(nil, ctx.Err())
+			return nil, session.err
+	}
+
+	go session.run(ctx, opts, receiverClient, connCh, errCh, sink)
+
+	return session, nil
+}
+
+// run waits for the sender and receives its payload.
+func (s *RequestSession) run(ctx context.Context, opts Options, receiverClient *receiver.Receiver,
+	connCh <-chan *websocket.Conn, errCh <-chan error, sink Sink) {
+	select {
+		case wsConn := <-connCh:
+			s.finish(receivePayload(ctx, opts, receiverClient, wsConn, sink))
+
+		case err := <-errCh:
+			s.finish(nil, err)
+
+		case <-ctx.Done():
+			s.finish(nil, ctx.Err())
+	}
+}
+
+// finish ends the session with the received files or the classified err.
+func (s *RequestSession) finish(result *Result, err error) {
+	s.cancel()
+	s.result = result
+	s.err = newError(err, false)
+	close(s.done)
+}
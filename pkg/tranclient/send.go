@@ -0,0 +1,485 @@
+package tranclient
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"net"
+	"time"
+	"sync"
+	"context"
+
+	"github.com/gorilla/websocket"
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models"
+	"github.com/abdfnx/tran/constants"
+	"github.com/abdfnx/tran/core/tranx"
+	"github.com/abdfnx/tran/core/sender"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// Session is a running send, it ends once the receiver got the payload, an error occurred or it was closed.
+type Session struct {
+	code       models.Password
+	link       string
+	expires    time.Time
+	relay      *tranx.Server
+	sources    []string
+	selections []*os.File
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{}
+	err        error
+	mu         sync.Mutex
+}
+
+// Code returns the code the receiver needs to enter, the password of the session,
+// followed by the address of the tranx server if the receiver can not know it, see tools.RelayCode.
+func (s *Session) Code() models.Password {
+	return s.code
+}
+
+// Link returns the tran:// link naming the tranx server and the password, which Receive accepts as the code.
+// It is empty if the session does not use a tranx server.
+func (s *Session) Link() string {
+	return s.link
+}
+
+// Expires returns when the tranx server stops waiting for a receiver with the code,
+// it is zero if the session does not use a tranx server or the receiver requested the payload.
+func (s *Session) Expires() time.Time {
+	return s.expires
+}
+
+// Done returns a channel that is closed when the session has ended.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Wait blocks until the session has ended and returns its error, if any.
+func (s *Session) Wait() error {
+	<-s.done
+
+	return s.err
+}
+
+// Close aborts the session and waits for it to clean up.
+func (s *Session) Close() error {
+	s.cancel()
+
+	return s.Wait()
+}
+
+// Send reads, archives and compresses the sources and announces them on the tranx server,
+// or sends them to the receiver that requested them with the code of opts.To.
+// It returns as soon as the password is known, the transfer itself continues in the returned Session.
+func Send(ctx context.Context, opts Options, sources []string) (*Session, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	session := &Session{sources: sources, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+
+	var request models.Password
+
+	if opts.To != "" {
+		var host string
+		var port int
+		var err error
+
+		request, host, port, err = tools.ParseCode(opts.To)
+		if err != nil {
+			cancel()
+			return nil, &Error{Kind: KindAuth, Err: fmt.Errorf("error parsing the code of the request: %w", err)}
+		}
+
+		// the code names the tranx server of the receiver
+		if host != "" {
+			opts.TranxAddress, opts.TranxPort = host, port
+			opts.Relays = nil
+		}
+
+		session.code = request
+	}
+
+	// the receiver reaches the in-process tranx server at the address encoded into the code
+	var relayIP net.IP
+
+	if opts.LocalRelay {
+		var err error
+
+		relayIP, err = tools.OutboundIP()
+		if err != nil {
+			cancel()
+			return nil, newError(fmt.Errorf("could not determine the address of the local relay: %w", err), false)
+		}
+
+		var relayAddr *net.TCPAddr
+
+		session.relay, relayAddr, err = startLocalRelay(opts.Direct)
+		if err != nil {
+			cancel()
+			return nil, newError(fmt.Errorf("could not start the local relay: %w", err), false)
+		}
+
+		// a relay bound to an address is only reached there
+		opts.TranxAddress, opts.TranxPort = "127.0.0.1", relayAddr.Port
+		if !relayAddr.IP.IsUnspecified() {
+			relayIP, opts.TranxAddress = relayAddr.IP, relayAddr.IP.String()
+		}
+
+		opts.Relays = nil
+	}
+
+	files, err := tools.ReadFiles(sources)
+	if err != nil {
+		session.stopRelay()
+		cancel()
+
+		return nil, newError(err, false)
+	}
+
+	// communicate ui updates on this channel between senderClient and the event handler
+	uiCh := make(chan sender.UIUpdate)
+	senderClient := sender.WithUI(sender.NewSender(opts.TranOptions), uiCh)
+	sender.WithSelection(senderClient, session.selectFiles)
+	if request != "" {
+		sender.WithRequest(senderClient, request)
+	}
+
+	// every receiver of a broadcast joins a sender connection of its own, the first one announces the broadcast
+	var joinedCh chan bool
+	if opts.MaxReceivers > 1 {
+		joinedCh = make(chan bool, opts.MaxReceivers)
+		sender.WithBroadcast(senderClient, "", "", opts.MaxReceivers, joinedCh)
+	}
+
+	go forwardSenderUpdates(opts, uiCh, 1, session.done)
+
+	errCh := make(chan error, 2)
+	readyCh := make(chan bool)
+	payloadCh := make(chan *os.File, 1)
+	prepared := &payloadFile{}
+
+	// a broadcast outlives the failure of a single connection, but not the failure to prepare the payload
+	prepareErrCh := errCh
+	if opts.MaxReceivers > 1 {
+		prepareErrCh = make(chan error, 1)
+	}
+
+	// read, archive and compress files in parallel
+	go preparePayload(ctx, opts, senderClient, files, sources, prepared, readyCh, payloadCh, prepareErrCh)
+
+	passCh := make(chan models.Password, 1)
+	startServerCh := make(chan sender.ServerOptions, 1)
+	relayCh := make(chan *websocket.Conn, 1)
+
+	// without a server the transfer is relayed through tranx
+	if opts.Direct.Disabled {
+		startServerCh = nil
+	}
+
+	if opts.LAN {
+		// announce the sender on the local network, the receiver connects to it directly
+		go func() {
+			wsConn, err := senderClient.ConnectLAN(ctx, passCh, readyCh)
+			if err != nil {
+				errCh <- newError(fmt.Errorf("failed to connect on the local network: %w", err), true)
+
+				return
+			}
+
+			relayCh <- wsConn
+		}()
+	} else {
+		// initiate communications with tranx-server, the fastest one that is reachable,
+		// without the tranx server in the code the receiver may be waiting on any of them
+		go func() {
+			relays, retry := rankRelays(ctx, relayAddresses(opts), opts.Proxy), isUnreachable
+			if request != "" {
+				relays, retry = relayAddresses(opts), isUnknownOrUnreachable
+			}
+
+			err := tryRelays(relays, retry, func(host string, port int) error {
+				return senderClient.ConnectToTranx(ctx, host, port, passCh, startServerCh, readyCh, relayCh)
+			})
+
+			if err != nil {
+				errCh <- newError(fmt.Errorf("failed to communicate with tranx server: %w", err), true)
+			}
+		}()
+	}
+
+	// the receiver that requested the payload knows the code already
+	var password models.Password
+
+	if request == "" {
+		select {
+			case password = <-passCh:
+				session.code = password
+				if !opts.LAN {
+					session.expires = time.Now().Add(codeExpiry(opts.Expires))
+				}
+
+				// the receiver has to connect to the same tranx server
+				switch {
+					case session.relay != nil:
+						session.code = models.Password(tools.RelayCode(password, relayIP.String(), opts.TranxPort))
+						session.link = tools.ShareLink(password, relayIP.String(), opts.TranxPort)
+
+					// the receiver finds the sender on the local network
+					case opts.LAN:
+
+					case len(opts.Relays) > 0:
+						session.code = models.Password(tools.RelayCode(password, senderClient.TranxAddress(), senderClient.TranxPort()))
+						session.link = tools.ShareLink(password, senderClient.TranxAddress(), senderClient.TranxPort())
+
+					default:
+						session.link = tools.ShareLink(password, senderClient.TranxAddress(), senderClient.TranxPort())
+				}
+
+			case err := <-errCh:
+				session.finish(opts, err, payloadCh)
+				return nil, session.err
+
+			case <-ctx.Done():
+				session.finish(opts, ctx.Err(), payloadCh)
+				return nil, session.err
+		}
+	}
+
+	if opts.MaxReceivers > 1 {
+		go session.broadcast(ctx, opts, senderClient, password, startServerCh, relayCh, errCh, joinedCh, prepareErrCh, readyCh, prepared, payloadCh)
+
+		return session, nil
+	}
+
+	go func() {
+		session.finish(opts, session.transfer(ctx, opts, senderClient, startServerCh, relayCh, errCh), payloadCh)
+	}()
+
+	return session, nil
+}
+
+// codeExpiry returns how long tranx keeps a code valid if the sender asks for expires, see tranx.codeExpiry.
+func codeExpiry(expires time.Duration) time.Duration {
+	if expires <= 0 {
+		return constants.RECEIVER_CONNECT_TIMEOUT
+	}
+
+	if expires > constants.MAX_CODE_EXPIRY {
+		return constants.MAX_CODE_EXPIRY
+	}
+
+	return expires.Truncate(time.Second)
+}
+
+// transfer waits for the receiver of senderClient and transfers the payload to it, see transferConnection and transferServed.
+func (s *Session) transfer(ctx context.Context, opts Options, senderClient *sender.Sender, startServerCh <-chan sender.ServerOptions,
+	relayCh <-chan *websocket.Conn, errCh <-chan error) error {
+	if opts.LAN || opts.Direct.Disabled {
+		return s.transferConnection(ctx, senderClient, relayCh, errCh)
+	}
+
+	return s.transferServed(ctx, senderClient, startServerCh, relayCh, errCh)
+}
+
+// transferConnection transfers the payload over the only connection to the receiver,
+// the one of a receiver on the local network or the one relayed through tranx.
+func (s *Session) transferConnection(ctx context.Context, senderClient *sender.Sender,
+	connCh <-chan *websocket.Conn, errCh <-chan error) error {
+	select {
+		case wsConn := <-connCh:
+			return senderClient.Transfer(ctx, wsConn)
+
+		case err := <-errCh:
+			return err
+
+		case <-ctx.Done():
+			return ctx.Err()
+	}
+}
+
+// transferServed transfers the payload either directly or through the tranx relay.
+func (s *Session) transferServed(ctx context.Context, senderClient *sender.Sender, startServerCh <-chan sender.ServerOptions,
+	relayCh <-chan *websocket.Conn, errCh <-chan error) error {
+	var serverOptions sender.ServerOptions
+
+	select {
+		case serverOptions = <-startServerCh:
+
+		case err := <-errCh:
+			return err
+
+		case <-ctx.Done():
+			return ctx.Err()
+	}
+
+	// attach server to senderClient
+	senderClient = sender.WithServer(senderClient, serverOptions)
+	resultCh := make(chan error, 2)
+
+	go func() {
+		resultCh <- senderClient.StartServer(ctx)
+	}()
+
+	// prepare a fallback to relay communications through tranx if direct communications unavailable
+	go func() {
+		if relayWsConn, ok := <-relayCh; ok {
+			resultCh <- senderClient.Transfer(ctx, relayWsConn)
+			senderClient.CloseServer()
+		}
+	}()
+
+	select {
+		case err := <-resultCh:
+			return err
+
+		case err := <-errCh:
+			senderClient.CloseServer()
+			return err
+
+		case <-ctx.Done():
+			senderClient.CloseServer()
+			return ctx.Err()
+	}
+}
+
+// finish removes the temporary payload once it is prepared and ends the session with the classified err,
+// preparing the payload stops early as the session is cancelled first.
+func (s *Session) finish(opts Options, err error, payloadCh <-chan *os.File) {
+	s.cancel()
+
+	if payload := <-payloadCh; payload != nil {
+		payload.Close()
+		os.Remove(payload.Name())
+	}
+
+	s.mu.Lock()
+	for _, selection := range s.selections {
+		selection.Close()
+		os.Remove(selection.Name())
+	}
+	s.mu.Unlock()
+
+	if err == nil {
+		opts.emit(Event{Type: EventFinished})
+	}
+
+	s.stopRelay()
+	s.err = newError(err, false)
+	close(s.done)
+}
+
+// stopRelay stops the in-process tranx server of the session, if any.
+func (s *Session) stopRelay() {
+	if s.relay == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), constants.SHUTDOWN_PERIOD)
+	defer cancel()
+
+	s.relay.Stop(ctx)
+}
+
+// selectFiles prepares the payload of the sources matching the patterns a receiver selected, compressed with compression,
+// the payloads are removed once the session has ended.
+func (s *Session) selectFiles(only []string, compression protocol.Compression) (io.Reader, int64, error) {
+	files, err := tools.ReadFiles(s.sources)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	payload, payloadSize, err := tools.ArchiveAndCompressFiles(s.ctx, files, only, compression)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.mu.Lock()
+	s.selections = append(s.selections, payload)
+	s.mu.Unlock()
+
+	return payload, payloadSize, nil
+}
+
+// payloadFile names the prepared payload, so that every connection of a broadcast can read it on its own.
+type payloadFile struct {
+	name        string
+	size        int64
+	manifest    *protocol.Manifest
+	compression protocol.Compression
+}
+
+// preparePayload archives and compresses the files into the payload of the sender, readyCh is closed once it is prepared.
+// Exactly one value is sent on payloadCh, the temporary payload file or nil on failure. It stops early once ctx is done.
+func preparePayload(ctx context.Context, opts Options, senderClient *sender.Sender, files []*os.File, fileNames []string, prepared *payloadFile,
+	readyCh chan<- bool, payloadCh chan<- *os.File, errCh chan<- error) {
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	manifest, err := tools.FilesManifest(files, opts.Note)
+	if err != nil {
+		payloadCh <- nil
+		errCh <- fmt.Errorf("error during file preparation: %w", err)
+
+		return
+	}
+
+	opts.emit(Event{Type: EventFileInfo, Files: fileNames, Bytes: manifest.Size})
+
+	// auto skips compressing payloads that do not shrink
+	compression, err := tools.ParseCompression(opts.Compression)
+	if err == nil {
+		compression, err = tools.ChooseCompression(files, compression)
+	}
+
+	if err != nil {
+		payloadCh <- nil
+		errCh <- fmt.Errorf("error during file preparation: %w", err)
+
+		return
+	}
+
+	tempFile, fileSize, err := tools.ArchiveAndCompressFiles(ctx, files, nil, compression)
+	if err != nil {
+		payloadCh <- nil
+		errCh <- fmt.Errorf("error compressing files: %w", err)
+
+		return
+	}
+
+	payloadCh <- tempFile
+	sender.WithManifest(sender.WithPayload(senderClient, tempFile, fileSize), manifest)
+	sender.WithCompression(senderClient, compression)
+	*prepared = payloadFile{name: tempFile.Name(), size: fileSize, manifest: manifest, compression: compression}
+	opts.emit(Event{Type: EventFileInfo, Files: fileNames, Bytes: fileSize})
+	close(readyCh)
+	opts.emit(Event{Type: EventReady})
+}
+
+// forwardSenderUpdates reports the updates of the sender of receiver as events until the session has ended.
+func forwardSenderUpdates(opts Options, uiCh <-chan sender.UIUpdate, receiver int, done <-chan struct{}) {
+	for {
+		select {
+			case update := <-uiCh:
+				switch update.State {
+					case sender.SendingData:
+						opts.emit(Event{Type: EventProgress, Progress: update.Progress, ETA: update.ETA, Receiver: receiver})
+
+					// make sure progress is 100 if connection is to be closed
+					case sender.WaitForCloseMessage:
+						opts.emit(Event{Type: EventProgress, Progress: 1, Receiver: receiver})
+				}
+
+			case <-done:
+				return
+		}
+	}
+}
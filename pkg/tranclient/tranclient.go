@@ -0,0 +1,76 @@
+// Package tranclient is the Go client library for sending and receiving files with tran.
+//
+// It drives the whole transfer (compression, tranx negotiation, direct or relayed transfer)
+// without any UI, reports the progress through Options.OnEvent and never exits the process.
+package tranclient
+
+import (
+	"time"
+	"context"
+
+	"github.com/abdfnx/tran/tools"
+	"github.com/abdfnx/tran/models"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// Options specifies how a transfer is performed.
+type Options struct {
+	models.TranOptions
+
+	// OnEvent is called for every Event of the transfer, it is called synchronously and must not block.
+	OnEvent func(Event)
+
+	// Review is called with the manifest of the payload before it is received, of the files matching TranOptions.Only if set. The payload is declined
+	// unless the returned Decision accepts it. ctx is done once the review timed out. Every payload is accepted if Review is nil.
+	Review func(ctx context.Context, manifest *Manifest) Decision
+}
+
+// Manifest describes the payload before it is received, see Options.Review.
+// Senders of older versions do not describe their payload, their manifest lists no files and Size is the compressed size.
+type Manifest = protocol.Manifest
+
+// ManifestFile is a file listed by a Manifest.
+type ManifestFile = protocol.ManifestFile
+
+// Sink stores the files Receive and Request expand, see DirSink.
+type Sink = tools.Sink
+
+// DirSink returns the Sink that stores the files below dir, the current working directory if dir is empty.
+func DirSink(dir string) Sink {
+	return tools.DirSink(dir)
+}
+
+// Decision is the outcome of the review of a Manifest.
+type Decision struct {
+	Accept bool
+	Only   []string // paths of the files of the manifest to request, all of them if empty
+}
+
+// EventType specifies the kind of an Event.
+type EventType int
+
+const (
+	EventFileInfo EventType = iota // Names and size of the payload are known
+	EventReady                     // The payload is compressed and ready to be sent
+	EventProgress                  // The transfer progress has changed
+	EventFinished                  // The transfer has completed
+)
+
+// Event reports the state of a transfer.
+type Event struct {
+	Type     EventType
+	Files    []string
+	Bytes    int64
+	Progress float32
+	ETA      time.Duration // estimated time until the receiver has received the payload when sending, zero if unknown
+	Receiver int // receiver the progress is about, counting from one, when sending to several receivers
+}
+
+// emit is a helper function that reports an event if a handler is attached.
+func (o Options) emit(event Event) {
+	if o.OnEvent == nil {
+		return
+	}
+
+	o.OnEvent(event)
+}
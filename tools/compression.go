@@ -0,0 +1,331 @@
+package tools
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"sync"
+	"bytes"
+	"strconv"
+	"strings"
+	"path/filepath"
+
+	"github.com/klauspost/pgzip"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/abdfnx/tran/constants"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// compressedExtensions are the extensions of files that are compressed already, the auto compression does not sample them.
+var compressedExtensions = map[string]bool{
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".lz4": true, ".7z": true, ".rar": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true, ".avif": true,
+	".mp4": true, ".mkv": true, ".mov": true, ".webm": true, ".avi": true, ".m4v": true,
+	".mp3": true, ".aac": true, ".ogg": true, ".opus": true, ".flac": true, ".m4a": true,
+	".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".jar": true, ".apk": true, ".whl": true, ".pdf": true,
+}
+
+// ParseCompression parses the compression the user chose, an algorithm optionally followed by a level like zstd:19.
+// gzip takes the levels 1 to 9 and zstd the levels 1 to 22, an empty spec is auto.
+func ParseCompression(spec string) (protocol.Compression, error) {
+	if spec == "" {
+		return protocol.Compression{Algorithm: protocol.CompressionAuto}, nil
+	}
+
+	algorithm, levelSpec, hasLevel := strings.Cut(strings.ToLower(spec), ":")
+	compression := protocol.Compression{Algorithm: algorithm}
+
+	var maxLevel int
+
+	switch algorithm {
+		case protocol.CompressionGzip:
+			maxLevel = 9
+
+		case protocol.CompressionZstd:
+			maxLevel = 22
+
+		case protocol.CompressionNone, protocol.CompressionAuto:
+
+		default:
+			return compression, fmt.Errorf("unknown compression %q, it is one of gzip, zstd, none and auto", algorithm)
+	}
+
+	if !hasLevel {
+		return compression, nil
+	}
+
+	level, err := strconv.Atoi(levelSpec)
+	if maxLevel == 0 {
+		return compression, fmt.Errorf("the compression %s takes no level", algorithm)
+	}
+
+	if err != nil || level < 1 || level > maxLevel {
+		return compression, fmt.Errorf("the level of %s is between 1 and %d, not %q", algorithm, maxLevel, levelSpec)
+	}
+
+	compression.Level = level
+
+	return compression, nil
+}
+
+// ChooseCompression resolves the auto compression for files, any other compression is returned as it is.
+// Files with the extension of a compressed format count as incompressible, the beginning of a few others is compressed
+// to estimate how much of the payload zstd would save. The payload is not compressed if the saving is too small to pay off.
+func ChooseCompression(files []*os.File, compression protocol.Compression) (protocol.Compression, error) {
+	if compression.Algorithm != protocol.CompressionAuto {
+		return compression, nil
+	}
+
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return compression, err
+	}
+
+	defer encoder.Close()
+
+	var total, compressed, sampled, sampledSize, sampledFiles int64
+	sample := make([]byte, constants.COMPRESSION_SAMPLE_BYTES)
+
+	for _, file := range files {
+		err := filepath.Walk(file.Name(), func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+
+			total += info.Size()
+
+			if compressedExtensions[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+
+			compressed += info.Size()
+
+			if sampledFiles >= constants.COMPRESSION_SAMPLE_FILES {
+				return nil
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+
+			defer f.Close()
+
+			n, err := io.ReadFull(f, sample)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+
+			sampled += int64(n)
+			sampledSize += int64(len(encoder.EncodeAll(sample[:n], nil)))
+			sampledFiles++
+
+			return nil
+		})
+
+		if err != nil {
+			return compression, err
+		}
+	}
+
+	// the files that were not sampled are assumed to compress like the sampled ones
+	var saving float64
+	if total > 0 && sampled > 0 {
+		saving = float64(compressed) * (1 - float64(sampledSize) / float64(sampled)) / float64(total)
+	}
+
+	if total == 0 || saving >= constants.MIN_COMPRESSION_SAVING {
+		return protocol.Compression{Algorithm: protocol.CompressionZstd}, nil
+	}
+
+	return protocol.Compression{Algorithm: protocol.CompressionNone}, nil
+}
+
+// nopWriteCloser passes the payload on uncompressed.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// compressWriter returns a writer that compresses what is written to it into w, it has to be closed to flush the payload.
+// The payload is compressed in chunks on a Pipeline, see compressStage.
+func compressWriter(w io.Writer, compression protocol.Compression) (io.WriteCloser, error) {
+	if compression.Algorithm == protocol.CompressionNone {
+		return nopWriteCloser{w}, nil
+	}
+
+	stage, release, err := compressStage(compression)
+	if err != nil {
+		return nil, err
+	}
+
+	return newChunkWriter(w, release, stage), nil
+}
+
+// compressStage returns the Stage that compresses every chunk on its own, into a gzip member or a zstd frame.
+// The compressed chunks one after the other decompress as one stream, see decompressReader.
+// release frees the encoders once the stage is not used anymore.
+func compressStage(compression protocol.Compression) (stage Stage, release func(), err error) {
+	switch compression.Algorithm {
+		case protocol.CompressionGzip:
+			level := compression.Level
+			if level == 0 {
+				level = gzip.DefaultCompression
+			}
+
+			if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+				return nil, nil, err
+			}
+
+			writers := &sync.Pool{New: func() interface{} {
+				gw, _ := gzip.NewWriterLevel(nil, level)
+				return gw
+			}}
+
+			stage = func(chunk []byte) ([]byte, error) {
+				var compressed bytes.Buffer
+
+				gw := writers.Get().(*gzip.Writer)
+				defer writers.Put(gw)
+
+				gw.Reset(&compressed)
+				if _, err := gw.Write(chunk); err != nil {
+					return nil, err
+				}
+
+				if err := gw.Close(); err != nil {
+					return nil, err
+				}
+
+				return compressed.Bytes(), nil
+			}
+
+			return stage, func() {}, nil
+
+		case protocol.CompressionZstd:
+			var options []zstd.EOption
+			if compression.Level != 0 {
+				options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(compression.Level)))
+			}
+
+			encoder, err := zstd.NewWriter(nil, options...)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			stage = func(chunk []byte) ([]byte, error) {
+				return encoder.EncodeAll(chunk, nil), nil
+			}
+
+			return stage, func() { encoder.Close() }, nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown compression %q", compression.Algorithm)
+}
+
+// chunkWriter cuts what is written to it into chunks and pushes them to a Pipeline, the transformed chunks are written to w in order.
+type chunkWriter struct {
+	pipeline *Pipeline
+	buffer   []byte
+	release  func()
+	done     chan struct{}
+	err      error
+}
+
+func newChunkWriter(w io.Writer, release func(), stages ...Stage) *chunkWriter {
+	cw := &chunkWriter{pipeline: NewPipeline(stages...), release: release, done: make(chan struct{})}
+	go cw.drain(w)
+
+	return cw
+}
+
+// drain writes the transformed chunks to w, it stops the pipeline on the first error.
+func (cw *chunkWriter) drain(w io.Writer) {
+	defer close(cw.done)
+
+	for {
+		chunk, ok := cw.pipeline.Next()
+		if !ok {
+			return
+		}
+
+		out, err := chunk.Result()
+		if err == nil {
+			_, err = w.Write(out)
+		}
+
+		if err != nil {
+			cw.err = err
+			cw.pipeline.Stop()
+
+			return
+		}
+	}
+}
+
+func (cw *chunkWriter) Write(data []byte) (int, error) {
+	var written int
+
+	for len(data) > 0 {
+		if cw.buffer == nil {
+			cw.buffer = make([]byte, 0, constants.COMPRESSION_CHUNK_BYTES)
+		}
+
+		n := copy(cw.buffer[len(cw.buffer):cap(cw.buffer)], data)
+		cw.buffer = cw.buffer[:len(cw.buffer) + n]
+		data, written = data[n:], written + n
+
+		if len(cw.buffer) == cap(cw.buffer) && !cw.push() {
+			<-cw.done
+			return written, cw.err
+		}
+	}
+
+	return written, nil
+}
+
+// push pushes the buffered chunk, it reports false once the pipeline is stopped.
+func (cw *chunkWriter) push() bool {
+	chunk := cw.pipeline.Push(cw.buffer)
+	cw.buffer = nil
+
+	return chunk != nil
+}
+
+// Close pushes the last chunk and waits until all chunks are written.
+func (cw *chunkWriter) Close() error {
+	if len(cw.buffer) > 0 {
+		cw.push()
+	}
+
+	cw.pipeline.CloseInput()
+	<-cw.done
+	cw.release()
+
+	return cw.err
+}
+
+// decompressReader returns a reader that decompresses the payload read from r, compressed with algorithm.
+func decompressReader(r io.Reader, algorithm string) (io.ReadCloser, error) {
+	switch algorithm {
+		case protocol.CompressionGzip:
+			return pgzip.NewReader(r)
+
+		case protocol.CompressionZstd:
+			decoder, err := zstd.NewReader(r, zstd.WithDecoderMaxWindow(constants.ZSTD_MAX_WINDOW_BYTES), zstd.WithDecoderMaxMemory(constants.ZSTD_MAX_MEMORY_BYTES))
+			if err != nil {
+				return nil, err
+			}
+
+			return decoder.IOReadCloser(), nil
+
+		case protocol.CompressionNone:
+			return io.NopCloser(r), nil
+	}
+
+	return nil, fmt.Errorf("unknown compression %q", algorithm)
+}
@@ -0,0 +1,190 @@
+package tools
+
+import (
+	"io"
+	"os"
+	"bytes"
+	"errors"
+	"context"
+	"strings"
+	"testing"
+	"math/rand"
+	"path/filepath"
+
+	"github.com/abdfnx/tran/constants"
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	// a payload of several chunks, half of it compressible
+	random := rand.New(rand.NewSource(1))
+	payload := make([]byte, 3 * constants.COMPRESSION_CHUNK_BYTES + 123)
+	random.Read(payload[:len(payload) / 2])
+
+	for _, compression := range []protocol.Compression{
+		{Algorithm: protocol.CompressionGzip},
+		{Algorithm: protocol.CompressionGzip, Level: 1},
+		{Algorithm: protocol.CompressionZstd},
+		{Algorithm: protocol.CompressionZstd, Level: 19},
+		{Algorithm: protocol.CompressionNone},
+	} {
+		var compressed bytes.Buffer
+
+		cw, err := compressWriter(&compressed, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// writes of odd sizes span the chunks
+		for sent := 0; sent < len(payload); sent += 77777 {
+			end := sent + 77777
+			if end > len(payload) {
+				end = len(payload)
+			}
+
+			if _, err := cw.Write(payload[sent:end]); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := cw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		dr, err := decompressReader(&compressed, compression.Algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decompressed, err := io.ReadAll(dr)
+		if err != nil || !bytes.Equal(decompressed, payload) {
+			t.Errorf("%+v: the payload did not survive the round trip: %v", compression, err)
+		}
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		spec string
+		want protocol.Compression
+		ok   bool
+	}{
+		{"", protocol.Compression{Algorithm: protocol.CompressionAuto}, true},
+		{"auto", protocol.Compression{Algorithm: protocol.CompressionAuto}, true},
+		{"gzip", protocol.Compression{Algorithm: protocol.CompressionGzip}, true},
+		{"GZIP:9", protocol.Compression{Algorithm: protocol.CompressionGzip, Level: 9}, true},
+		{"zstd:19", protocol.Compression{Algorithm: protocol.CompressionZstd, Level: 19}, true},
+		{"none", protocol.Compression{Algorithm: protocol.CompressionNone}, true},
+		{"gzip:0", protocol.Compression{}, false},
+		{"gzip:10", protocol.Compression{}, false},
+		{"zstd:23", protocol.Compression{}, false},
+		{"zstd:fast", protocol.Compression{}, false},
+		{"none:1", protocol.Compression{}, false},
+		{"auto:3", protocol.Compression{}, false},
+		{"lz4", protocol.Compression{}, false},
+	}
+
+	for _, test := range tests {
+		compression, err := ParseCompression(test.spec)
+		if (err == nil) != test.ok || (test.ok && compression != test.want) {
+			t.Errorf("%q: got %+v, %v, want %+v", test.spec, compression, err, test.want)
+		}
+	}
+}
+
+func TestChooseCompression(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	noise := make([]byte, 256e3)
+	random.Read(noise)
+
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 5000)
+
+	tests := []struct {
+		name     string
+		contents map[string]string
+		want     string
+	}{
+		{"text", map[string]string{"a.txt": text, "b.log": text}, protocol.CompressionZstd},
+		{"random", map[string]string{"a.bin": string(noise)}, protocol.CompressionNone},
+		// compressed formats are not sampled, even if they would compress
+		{"compressed formats", map[string]string{"a.mp4": text, "b.zip": text}, protocol.CompressionNone},
+		{"mostly compressed formats", map[string]string{"a.mp4": strings.Repeat(text, 20), "b.txt": text}, protocol.CompressionNone},
+		{"empty", map[string]string{}, protocol.CompressionZstd},
+	}
+
+	for _, test := range tests {
+		source := filepath.Join(t.TempDir(), "files")
+		writeTree(t, source, test.contents)
+
+		if err := os.MkdirAll(source, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		files, err := ReadFiles([]string{source})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		compression, err := ChooseCompression(files, protocol.Compression{Algorithm: protocol.CompressionAuto})
+		files[0].Close()
+
+		if err != nil || compression.Algorithm != test.want {
+			t.Errorf("%s: got %+v, %v, want %s", test.name, compression, err, test.want)
+		}
+	}
+
+	// a compression the user chose is kept
+	chosen := protocol.Compression{Algorithm: protocol.CompressionGzip, Level: 3}
+	if compression, err := ChooseCompression(nil, chosen); err != nil || compression != chosen {
+		t.Errorf("got %+v, %v, want %+v", compression, err, chosen)
+	}
+}
+
+func TestArchiveRemovesTheTempFile(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+
+	source := filepath.Join(t.TempDir(), "files")
+	writeTree(t, source, map[string]string{"a.txt": "a"})
+
+	files, err := ReadFiles([]string{source})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer files[0].Close()
+
+	if _, _, err := ArchiveAndCompressFiles(context.Background(), files, nil, protocol.Compression{Algorithm: "lz4"}); err == nil {
+		t.Fatal("the files were compressed with an unknown compression")
+	}
+
+	if entries, err := os.ReadDir(tempDir); err != nil || len(entries) > 0 {
+		t.Errorf("the temporary files %v, %v were left behind", entries, err)
+	}
+}
+
+func TestArchivingStopsOnceTheContextIsDone(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+
+	source := filepath.Join(t.TempDir(), "files")
+	writeTree(t, source, map[string]string{"a.txt": "a"})
+
+	files, err := ReadFiles([]string{source})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer files[0].Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := ArchiveAndCompressFiles(ctx, files, nil, protocol.Compression{Algorithm: protocol.CompressionZstd}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	if entries, err := os.ReadDir(tempDir); err != nil || len(entries) > 0 {
+		t.Errorf("the temporary files %v, %v were left behind", entries, err)
+	}
+}
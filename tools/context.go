@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"io"
+	"net"
+	"time"
+	"errors"
+	"context"
+
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// WithTimeout is like context.WithTimeout, except that a zero timeout never expires.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// contextWriter writes to w until ctx is done, from then on every write fails with the error of ctx.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw contextWriter) Write(data []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return cw.w.Write(data)
+}
+
+// PhaseError translates an error that occurred during a phase of the transfer,
+// into the context error if ctx is done, or into a protocol.TimeoutError if a deadline expired.
+func PhaseError(ctx context.Context, phase protocol.Phase, timeout time.Duration, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &protocol.TimeoutError{Phase: phase, Limit: timeout}
+	}
+
+	return err
+}
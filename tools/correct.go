@@ -0,0 +1,180 @@
+package tools
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// sortedWords holds the words of all wordlists in order, to complete words from.
+var sortedWords = sortWords(knownWords)
+
+func sortWords(words map[string]bool) []string {
+	sorted := make([]string, 0, len(words))
+	for word := range words {
+		sorted = append(sorted, word)
+	}
+
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+// CorrectCode fixes the typical typos of a code entered by hand before it is parsed: upper case letters,
+// words separated by spaces instead of dashes and words that are a letter or two off a word of the wordlists.
+// A word is only replaced if exactly one word is the closest to it, the words of a password made by CustomPassword
+// are never replaced and links are returned unchanged.
+func CorrectCode(code string) string {
+	code = strings.TrimSpace(code)
+	if IsLink(code) {
+		return code
+	}
+
+	passStr, address, hasAddress := strings.Cut(code, "@")
+
+	if id, phrase, custom := strings.Cut(passStr, CustomPasswordSeparator); custom {
+		passStr = strings.TrimSpace(id) + CustomPasswordSeparator + strings.Join(codeFields(phrase), "-")
+	} else {
+		parts := codeFields(passStr)
+
+		// the first part is the numeric id
+		for i := 1; i < len(parts); i++ {
+			parts[i] = correctWord(parts[i])
+		}
+
+		passStr = strings.Join(parts, "-")
+	}
+
+	if hasAddress {
+		return passStr + "@" + address
+	}
+
+	return passStr
+}
+
+// codeFields splits the lower cased words of a code entered by hand, separated by dashes, underscores or spaces.
+func codeFields(code string) []string {
+	return strings.FieldsFunc(strings.ToLower(code), func(r rune) bool {
+		return r == '-' || r == '_' || unicode.IsSpace(r)
+	})
+}
+
+// correctWord returns the only word of the wordlists closest to word, word itself if there is none.
+func correctWord(word string) string {
+	if knownWords[word] {
+		return word
+	}
+
+	// short words are too close to each other to allow two typos
+	maxDistance := 1
+	if len(word) > 5 {
+		maxDistance = 2
+	}
+
+	best, bestDistance, ties := word, maxDistance+1, 0
+
+	for _, candidate := range sortedWords {
+		// the limit has to tell ties apart from worse candidates
+		distance := editDistance(word, candidate, bestDistance+1)
+
+		switch {
+			case distance < bestDistance:
+				best, bestDistance, ties = candidate, distance, 0
+
+			case distance == bestDistance:
+				ties++
+		}
+	}
+
+	if bestDistance > maxDistance || ties > 0 {
+		return word
+	}
+
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b, or limit if it is at least limit.
+func editDistance(a, b string, limit int) int {
+	if len(a)-len(b) >= limit || len(b)-len(a) >= limit {
+		return limit
+	}
+
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		rowMin := i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+			rowMin = minInt(rowMin, current[j])
+		}
+
+		if rowMin >= limit {
+			return limit
+		}
+
+		previous, current = current, previous
+	}
+
+	return minInt(previous[len(b)], limit)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// CompleteCode completes the last word of a code being entered, as far as the words of the wordlists starting with it agree.
+// It returns the completed code and the words the last word can still become, the words chosen by the sender are not completed.
+func CompleteCode(code string) (string, []string) {
+	if IsLink(code) || strings.Contains(code, "@") || isCustomPassword(code) {
+		return code, nil
+	}
+
+	i := strings.LastIndex(code, "-")
+	if i < 0 {
+		// the numeric id is not completed
+		return code, nil
+	}
+
+	prefix := strings.ToLower(code[i+1:])
+	if prefix == "" {
+		return code, nil
+	}
+
+	start := sort.SearchStrings(sortedWords, prefix)
+	end := start
+
+	for end < len(sortedWords) && strings.HasPrefix(sortedWords[end], prefix) {
+		end++
+	}
+
+	matches := sortedWords[start:end]
+	if len(matches) == 0 {
+		return code, nil
+	}
+
+	// the matches are sorted, so the first and the last one share the prefix shared by all of them
+	first, last := matches[0], matches[len(matches)-1]
+	common := 0
+
+	for common < len(first) && common < len(last) && first[common] == last[common] {
+		common++
+	}
+
+	return code[:i+1] + first[:common], matches
+}
@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"net"
 	"errors"
+	"context"
 	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
+	"github.com/abdfnx/tran/core/crypt"
+	"github.com/abdfnx/tran/models/protocol"
 	"github.com/AlecAivazis/survey/v2/terminal"
 )
 
@@ -34,6 +38,35 @@ func IsUserCancellation(err error) bool {
 	return errors.Is(err, CancelError) || errors.Is(err, terminal.InterruptErr)
 }
 
+// NewTransferErrorPayload describes err to the other client of a transfer.
+func NewTransferErrorPayload(err error) protocol.TransferErrorPayload {
+	var timeoutErr *protocol.TimeoutError
+	var wrongMessageErr *protocol.WrongMessageTypeError
+
+	switch {
+		case errors.Is(err, context.Canceled) || IsUserCancellation(err):
+			return protocol.TransferErrorPayload{Code: protocol.ErrorCancelled, Message: "the transfer was cancelled"}
+
+		case errors.As(err, &timeoutErr):
+			return protocol.TransferErrorPayload{Code: protocol.ErrorTimeout, Message: timeoutErr.Error()}
+
+		case errors.Is(err, protocol.ErrDeclined):
+			return protocol.TransferErrorPayload{Code: protocol.ErrorDeclined, Message: protocol.ErrDeclined.Error()}
+
+		case errors.Is(err, syscall.ENOSPC):
+			return protocol.TransferErrorPayload{Code: protocol.ErrorDiskFull, Message: "there is no space left on the device"}
+
+		case errors.Is(err, crypt.ErrVerification):
+			return protocol.TransferErrorPayload{Code: protocol.ErrorVerification, Message: "a message failed the integrity verification"}
+
+		case errors.As(err, &wrongMessageErr):
+			return protocol.TransferErrorPayload{Code: protocol.ErrorUnsynchronized, Message: wrongMessageErr.Error()}
+
+		default:
+			return protocol.TransferErrorPayload{Code: protocol.ErrorUnknown, Message: err.Error()}
+	}
+}
+
 func MutuallyExclusive(message string, conditions ...bool) error {
 	numTrue := 0
 
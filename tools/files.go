@@ -4,13 +4,15 @@ import (
 	"io"
 	"os"
 	"fmt"
+	"path"
 	"bufio"
+	"context"
 	"strings"
 	"archive/tar"
 	"path/filepath"
 
-	"github.com/klauspost/pgzip"
 	"github.com/abdfnx/tran/constants"
+	"github.com/abdfnx/tran/models/protocol"
 )
 
 func ReadFiles(fileNames []string) ([]*os.File, error) {
@@ -28,59 +30,107 @@ func ReadFiles(fileNames []string) ([]*os.File, error) {
 	return files, nil
 }
 
-// ArchiveAndCompressFiles tars and gzip-compresses files into a temporary file, returning it
-// along with the resulting size
-func ArchiveAndCompressFiles(files []*os.File) (*os.File, int64, error) {
-	// chained writers -> writing to tw writes to gw -> writes to temporary file
+// ArchiveAndCompressFiles tars and compresses files into a temporary file, returning it
+// along with the resulting size. If only is not empty, just the files matching its patterns are archived, see MatchesAny.
+// Archiving stops once ctx is done, the temporary file is removed if the files can not be archived.
+func ArchiveAndCompressFiles(ctx context.Context, files []*os.File, only []string, compression protocol.Compression) (*os.File, int64, error) {
 	tempFile, err := os.CreateTemp(os.TempDir(), constants.SEND_TEMP_FILE_NAME_PREFIX)
 
 	if err != nil {
 		return nil, 0, err
 	}
 
+	size, err := archiveAndCompress(ctx, tempFile, files, only, compression)
+
+	if err != nil {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+
+		return nil, 0, err
+	}
+
+	return tempFile, size, nil
+}
+
+// archiveAndCompress writes the compressed archive of files to tempFile and rewinds it, every chunk of the files is checked against ctx.
+func archiveAndCompress(ctx context.Context, tempFile *os.File, files []*os.File, only []string, compression protocol.Compression) (int64, error) {
+	// chained writers -> writing to tw writes to cw -> writes to temporary file
 	tempFileWriter := bufio.NewWriter(tempFile)
-	gw := pgzip.NewWriter(tempFileWriter)
-	tw := tar.NewWriter(gw)
+	cw, err := compressWriter(tempFileWriter, compression)
+
+	if err != nil {
+		return 0, err
+	}
+
+	tw := tar.NewWriter(contextWriter{ctx: ctx, w: cw})
 
 	for _, file := range files {
-		err := addToTarArchive(tw, file)
+		err := ctx.Err()
+		if err == nil {
+			err = addToTarArchive(tw, file, only)
+		}
+
 		if err != nil {
-			return nil, 0, err
+			cw.Close()
+			return 0, err
 		}
 	}
 
-	tw.Close()
-	gw.Close()
+	if err := tw.Close(); err != nil {
+		cw.Close()
+		return 0, err
+	}
+
+	if err := cw.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := tempFileWriter.Flush(); err != nil {
+		return 0, err
+	}
 
-	tempFileWriter.Flush()
 	fileInfo, err := tempFile.Stat()
 
 	if err != nil {
-		return nil, 0, err
+		return 0, err
 	}
 
-	tempFile.Seek(0, io.SeekStart)
+	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
 
-	return tempFile, fileInfo.Size(), nil
+	return fileInfo.Size(), nil
 }
 
-// DecompressAndUnarchiveBytes gzip-decompresses and un-tars files into the current working directory
-// and returns the names and decompressed size of the created files
-func DecompressAndUnarchiveBytes(reader io.Reader) ([]string, int64, error) {
-	// chained readers -> gr reads from reader -> tr reads from gr
-	gr, err := pgzip.NewReader(reader)
+// DecompressAndUnarchiveBytes decompresses the payload compressed with algorithm and un-tars files into sink
+// and returns the names and decompressed size of the created files. If only is not empty,
+// just the files of the archive matching its patterns or inside the directories matching them are created.
+// Names that would leave the directory the payload is expanded into are rejected. If the sender sent the manifest,
+// the files it does not list are rejected as well, and expanding stops once the files exceed its count or size.
+func DecompressAndUnarchiveBytes(reader io.Reader, sink Sink, only []string, algorithm string, manifest *protocol.Manifest) ([]string, int64, error) {
+	// chained readers -> dr reads from reader -> tr reads from dr
+	dr, err := decompressReader(reader, algorithm)
 
 	if err != nil {
 		return nil, 0, err
 	}
 
-	defer gr.Close()
+	defer dr.Close()
 
-	tr := tar.NewReader(gr)
+	tr := tar.NewReader(dr)
 
 	var createdFiles []string
 	var decompressedSize int64
 
+	// a truncated manifest does not list every file, but its count and size are those of all files
+	var listed map[string]bool
+	if manifest != nil && !manifest.Truncated() {
+		listed = map[string]bool{}
+		for _, file := range manifest.Files {
+			listed[file.Path] = true
+		}
+	}
+
 	for {
 		header, err := tr.Next()
 
@@ -91,53 +141,102 @@ func DecompressAndUnarchiveBytes(reader io.Reader) ([]string, int64, error) {
 		if err != nil {
 			return nil, 0, err
 		}
+
 		if header == nil {
 			continue
 		}
 
-		cwd, err := os.Getwd()
-
-		if err != nil {
+		if err := checkName(header.Name); err != nil {
 			return nil, 0, err
 		}
 
-		fileTarget := filepath.Join(cwd, header.Name)
+		if !MatchesAny(header.Name, only) {
+			continue
+		}
 
 		switch header.Typeflag {
 			case tar.TypeDir:
-				if _, err := os.Stat(fileTarget); err != nil {
-					if err := os.MkdirAll(fileTarget, 0755); err != nil {
-						return nil, 0, err
-					}
+				if err := sink.MkdirAll(header.Name); err != nil {
+					return nil, 0, err
 				}
 
 			case tar.TypeReg:
-				f, err := os.OpenFile(fileTarget, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
+				if listed != nil && !listed[header.Name] {
+					return nil, 0, fmt.Errorf("the archive contains %q, which the manifest does not list", header.Name)
+				}
 
-				if err != nil {
-					return nil, 0, err
+				if manifest != nil && len(createdFiles) == manifest.Count {
+					return nil, 0, fmt.Errorf("the archive contains more than the %d files of the manifest", manifest.Count)
 				}
 
-				if _, err := io.Copy(f, tr); err != nil {
+				// the directory is not part of the archive if only some of its files were selected
+				if err := sink.MkdirAll(path.Dir(header.Name)); err != nil {
 					return nil, 0, err
 				}
 
-				fileInfo, err := f.Stat()
+				f, err := sink.Create(header.Name, os.FileMode(header.Mode))
 
 				if err != nil {
 					return nil, 0, err
 				}
 
-				decompressedSize += fileInfo.Size()
-				createdFiles = append(createdFiles, header.Name)
+				var content io.Reader = tr
+				if manifest != nil {
+					// one byte more than the manifest allows tells a payload that exceeds it
+					content = io.LimitReader(tr, manifest.Size-decompressedSize+1)
+				}
 
+				written, err := io.Copy(f, content)
 				f.Close()
+
+				if err != nil {
+					return nil, 0, err
+				}
+
+				if manifest != nil && decompressedSize+written > manifest.Size {
+					return nil, 0, fmt.Errorf("the archive holds more than the %d bytes of the manifest", manifest.Size)
+				}
+
+				decompressedSize += written
+				createdFiles = append(createdFiles, header.Name)
 		}
 	}
 
 	return createdFiles, decompressedSize, nil
 }
 
+// FilesManifest describes the files and the files inside the directories to the receiver, with the note of the sender
+func FilesManifest(files []*os.File, note string) (*protocol.Manifest, error) {
+	manifest := &protocol.Manifest{Note: note}
+
+	for _, file := range files {
+		err := filepath.Walk(file.Name(), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			manifest.Count++
+			manifest.Size += info.Size()
+
+			if len(manifest.Files) < protocol.MaxManifestFiles {
+				manifest.Files = append(manifest.Files, protocol.ManifestFile{Path: archiveName(file.Name(), path), Size: info.Size()})
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return manifest, nil
+}
+
 // Traverses files and directories (recursively) for total size in bytes
 func FilesTotalSize(files []*os.File) (int64, error) {
 	var size int64
@@ -163,15 +262,35 @@ func FilesTotalSize(files []*os.File) (int64, error) {
 	return size, nil
 }
 
+// archiveName returns the name in the archive of the file at path, found below the source root. It is relative to the directory
+// containing root, so that the receiver gets the source under its own name but not the path it has on the sender.
+func archiveName(root string, path string) string {
+	name, err := filepath.Rel(filepath.Dir(filepath.Clean(root)), path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+
+	return filepath.ToSlash(name)
+}
+
 // source: https://gist.github.com/mimoo/25fc9716e0f1353791f5908f94d6e726
-func addToTarArchive(tw *tar.Writer, file *os.File) error {
-	return filepath.Walk(file.Name(), func(file string, fi os.FileInfo, err error) error {
+func addToTarArchive(tw *tar.Writer, file *os.File, only []string) error {
+	root := file.Name()
+
+	return filepath.Walk(root, func(file string, fi os.FileInfo, err error) error {
+		name := archiveName(root, file)
+
+		// the files inside a directory that does not match may match on their own
+		if !MatchesAny(name, only) {
+			return nil
+		}
+
 		header, e := tar.FileInfoHeader(fi, file)
 		if e != nil {
 			return err
 		}
 
-		header.Name = filepath.ToSlash(file)
+		header.Name = name
 
 		if err := tw.WriteHeader(header); err != nil {
 			return err
@@ -0,0 +1,242 @@
+package tools
+
+import (
+	"io"
+	"os"
+	"sort"
+	"bytes"
+	"errors"
+	"context"
+	"reflect"
+	"testing"
+	"archive/tar"
+	"path/filepath"
+
+	"github.com/abdfnx/tran/models/protocol"
+)
+
+// writeTree creates the files of contents below dir, named by their slash separated paths.
+func writeTree(t *testing.T, dir string, contents map[string]string) {
+	for name, content := range contents {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// roundTrip archives the source with only and expands the archive into a new directory, selecting the files with only as well.
+func roundTrip(t *testing.T, source string, only []string) ([]string, string) {
+	files, err := ReadFiles([]string{source})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer files[0].Close()
+
+	manifest, err := FilesManifest(files, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compression := protocol.Compression{Algorithm: protocol.CompressionZstd}
+
+	archive, _, err := ArchiveAndCompressFiles(context.Background(), files, only, compression)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	dst := t.TempDir()
+
+	created, _, err := DecompressAndUnarchiveBytes(archive, DirSink(dst), only, compression.Algorithm, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(created)
+
+	return created, dst
+}
+
+func TestArchiveNamesAreRelativeToTheSource(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "nested", "logs")
+	writeTree(t, source, map[string]string{"app.txt": "app", "old/app.txt": "old", "app.json": "{}"})
+
+	tests := []struct {
+		only []string
+		want []string
+	}{
+		{nil, []string{"logs/app.json", "logs/app.txt", "logs/old/app.txt"}},
+		{[]string{"logs/*.txt"}, []string{"logs/app.txt"}},
+		{[]string{"logs/old"}, []string{"logs/old/app.txt"}},
+	}
+
+	for _, test := range tests {
+		created, dst := roundTrip(t, source, test.only)
+		if !reflect.DeepEqual(created, test.want) {
+			t.Errorf("with %q got %q, want %q", test.only, created, test.want)
+		}
+
+		for _, name := range created {
+			data, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+			want, _ := os.ReadFile(filepath.Join(filepath.Dir(source), filepath.FromSlash(name)))
+
+			if err != nil || string(data) != string(want) {
+				t.Errorf("%s holds %q, %v, want %q", name, data, err, want)
+			}
+		}
+	}
+}
+
+func TestManifestNamesTheArchivedFiles(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "photos")
+	writeTree(t, source, map[string]string{"a.jpg": "a", "trip/b.jpg": "bb"})
+
+	files, err := ReadFiles([]string{source})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer files[0].Close()
+
+	manifest, err := FilesManifest(files, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []protocol.ManifestFile{{Path: "photos/a.jpg", Size: 1}, {Path: "photos/trip/b.jpg", Size: 2}}
+	if !reflect.DeepEqual(manifest.Files, want) || manifest.Count != 2 || manifest.Size != 3 {
+		t.Errorf("got the manifest %+v, want the files %+v", manifest, want)
+	}
+}
+
+// tarEntry is a file of a crafted archive, a directory if its content is nil.
+type tarEntry struct {
+	name    string
+	content []byte
+}
+
+// craftArchive returns an uncompressed archive of entries.
+func craftArchive(t *testing.T, entries ...tarEntry) *bytes.Reader {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(entry.content))}
+		if entry.content == nil {
+			header.Typeflag, header.Mode = tar.TypeDir, 0755
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+
+		tw.Write(entry.content)
+	}
+
+	tw.Close()
+
+	return bytes.NewReader(archive.Bytes())
+}
+
+// memorySink stores the files in memory, without any check of their names.
+type memorySink map[string]*bytes.Buffer
+
+func (s memorySink) MkdirAll(name string) error {
+	return nil
+}
+
+func (s memorySink) Create(name string, mode os.FileMode) (io.WriteCloser, error) {
+	s[name] = &bytes.Buffer{}
+
+	return nopWriteCloser{s[name]}, nil
+}
+
+func TestExpandingRejectsNamesOutsideTheDirectory(t *testing.T) {
+	for _, name := range []string{"../evil.txt", "logs/../../evil.txt", "/etc/evil.txt", "..", `logs\..\..\evil.txt`} {
+		for _, sink := range []Sink{memorySink{}, DirSink(t.TempDir())} {
+			archive := craftArchive(t, tarEntry{name, []byte("evil")})
+
+			if _, _, err := DecompressAndUnarchiveBytes(archive, sink, nil, protocol.CompressionNone, nil); err == nil {
+				t.Errorf("%q was expanded into %T", name, sink)
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(t.TempDir()), "evil.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a file was created outside the directory: %v", err)
+	}
+}
+
+func TestDirSinkKeepsTheFilesInside(t *testing.T) {
+	sink := DirSink(t.TempDir())
+
+	for _, name := range []string{"../evil.txt", "/etc/evil.txt", "a/../../evil.txt"} {
+		if _, err := sink.Create(name, 0644); err == nil {
+			t.Errorf("DirSink created %q", name)
+		}
+
+		if err := sink.MkdirAll(name); err == nil {
+			t.Errorf("DirSink created the directory %q", name)
+		}
+	}
+}
+
+func TestDirSinkReplacesLongerFiles(t *testing.T) {
+	dst := t.TempDir()
+	writeTree(t, dst, map[string]string{"d/a.txt": "the old and longer content"})
+
+	archive := craftArchive(t, tarEntry{"d", nil}, tarEntry{"d/a.txt", []byte("new")})
+	if _, _, err := DecompressAndUnarchiveBytes(archive, DirSink(dst), nil, protocol.CompressionNone, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dst, "d", "a.txt")); err != nil || string(data) != "new" {
+		t.Errorf("the file holds %q, %v, want %q", data, err, "new")
+	}
+}
+
+func TestExpandingStopsAtTheManifest(t *testing.T) {
+	manifest := &protocol.Manifest{
+		Files: []protocol.ManifestFile{{Path: "d/a.txt", Size: 3}, {Path: "d/b.txt", Size: 3}},
+		Count: 2,
+		Size:  6,
+	}
+
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		ok      bool
+	}{
+		{"listed", []tarEntry{{"d", nil}, {"d/a.txt", []byte("aaa")}, {"d/b.txt", []byte("bbb")}}, true},
+		{"unlisted", []tarEntry{{"d/a.txt", []byte("aaa")}, {"d/c.txt", []byte("c")}}, false},
+		{"too many", []tarEntry{{"d/a.txt", []byte("aaa")}, {"d/b.txt", []byte("bbb")}, {"d/a.txt", []byte("a")}}, false},
+		{"too big", []tarEntry{{"d/a.txt", []byte("aaa")}, {"d/b.txt", []byte("bbbb")}}, false},
+	}
+
+	for _, test := range tests {
+		sink := memorySink{}
+
+		_, _, err := DecompressAndUnarchiveBytes(craftArchive(t, test.entries...), sink, nil, protocol.CompressionNone, manifest)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got %v, want ok %v", test.name, err, test.ok)
+		}
+
+		var written int
+		for _, content := range sink {
+			written += content.Len()
+		}
+
+		if written > int(manifest.Size)+1 {
+			t.Errorf("%s: %d bytes were written, the manifest allows %d", test.name, written, manifest.Size)
+		}
+	}
+}
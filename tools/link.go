@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"net/url"
+
+	"github.com/abdfnx/tran/models"
+)
+
+// LinkScheme is the scheme of the links made by ShareLink.
+const LinkScheme = "tran"
+
+// ShareLink returns the tran://host:port/password link naming the tranx server and the password.
+func ShareLink(password models.Password, host string, port int) string {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	link := url.URL{
+		Scheme: LinkScheme,
+		Host:   address,
+		Path:   "/" + string(password),
+	}
+
+	return link.String()
+}
+
+// IsLink reports whether code is a link made by ShareLink rather than a password.
+func IsLink(code string) bool {
+	return strings.HasPrefix(code, LinkScheme+"://")
+}
+
+// parseLink parses a link made by ShareLink, its query is ignored.
+func parseLink(link string) (models.Password, string, int, error) {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("link: %q is invalid: %w", link, err)
+	}
+
+	host, port, err := ParseRelay(parsed.Host)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("link: %q has an invalid tranx address: %w", link, err)
+	}
+
+	password, err := ParsePassword(strings.Trim(parsed.Path, "/"))
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	return password, host, port, nil
+}
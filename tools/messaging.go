@@ -2,6 +2,7 @@ package tools
 
 import (
 	"fmt"
+	"time"
 	"encoding/json"
 
 	"github.com/gorilla/websocket"
@@ -9,6 +10,11 @@ import (
 	"github.com/abdfnx/tran/models/protocol"
 )
 
+// abortWriteTimeout bounds the time spent notifying the other client of an aborted transfer.
+const abortWriteTimeout = 2 * time.Second
+
+// ReadTranxMessage reads a tranx message of the expected type,
+// a TranxToClientError message is returned as a *protocol.TranxError.
 func ReadTranxMessage(wsConn *websocket.Conn, expected protocol.TranxMessageType) (protocol.TranxMessage, error) {
 	msg := protocol.TranxMessage{}
 	err := wsConn.ReadJSON(&msg)
@@ -17,6 +23,15 @@ func ReadTranxMessage(wsConn *websocket.Conn, expected protocol.TranxMessageType
 		return protocol.TranxMessage{}, err
 	}
 
+	if msg.Type == protocol.TranxToClientError && expected != protocol.TranxToClientError {
+		errorPayload := protocol.TranxErrorPayload{}
+		if err = DecodePayload(msg.Payload, &errorPayload); err != nil {
+			return protocol.TranxMessage{}, err
+		}
+
+		return protocol.TranxMessage{}, &protocol.TranxError{Code: errorPayload.Code, Message: errorPayload.Message}
+	}
+
 	if msg.Type != expected {
 		return protocol.TranxMessage{}, fmt.Errorf("expected message type: %d. Got type: %d", expected, msg.Type)
 	}
@@ -24,11 +39,22 @@ func ReadTranxMessage(wsConn *websocket.Conn, expected protocol.TranxMessageType
 	return msg, nil
 }
 
-func WriteEncryptedMessage(wsConn *websocket.Conn, msg protocol.TransferMessage, crypt *crypt.Crypt) error {
+// WriteTranxError tells a client why tranx rejects its request, closing the connection is up to the caller.
+func WriteTranxError(wsConn *websocket.Conn, code protocol.TranxErrorCode, message string) error {
+	return wsConn.WriteJSON(protocol.TranxMessage{
+		Type: protocol.TranxToClientError,
+		Payload: protocol.TranxErrorPayload{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+func WriteEncryptedMessage(wsConn *websocket.Conn, msg protocol.TransferMessage, crypt crypt.Cipher) error {
 	json, err := json.Marshal(msg)
 
 	if err != nil {
-		return nil
+		return err
 	}
 
 	enc, err := crypt.Encrypt(json)
@@ -36,12 +62,12 @@ func WriteEncryptedMessage(wsConn *websocket.Conn, msg protocol.TransferMessage,
 		return err
 	}
 
-	wsConn.WriteMessage(websocket.BinaryMessage, enc)
-
-	return nil
+	return wsConn.WriteMessage(websocket.BinaryMessage, enc)
 }
 
-func ReadEncryptedMessage(wsConn *websocket.Conn, crypt *crypt.Crypt) (protocol.TransferMessage, error) {
+// ReadEncryptedMessage reads and decrypts a transfer message,
+// a TransferError message of the other client is returned as a *protocol.PeerError.
+func ReadEncryptedMessage(wsConn *websocket.Conn, crypt crypt.Cipher) (protocol.TransferMessage, error) {
 	_, enc, err := wsConn.ReadMessage()
 
 	if err != nil {
@@ -60,5 +86,19 @@ func ReadEncryptedMessage(wsConn *websocket.Conn, crypt *crypt.Crypt) (protocol.
 		return protocol.TransferMessage{}, err
 	}
 
+	if msg.Type == protocol.TransferError {
+		return msg, protocol.NewPeerError(msg.Payload)
+	}
+
 	return msg, nil
 }
+
+// WriteTransferError notifies the other client that the transfer is aborted for the reason in payload.
+func WriteTransferError(wsConn *websocket.Conn, crypt *crypt.Crypt, payload protocol.TransferErrorPayload) error {
+	wsConn.SetWriteDeadline(time.Now().Add(abortWriteTimeout))
+
+	return WriteEncryptedMessage(wsConn, protocol.TransferMessage{
+		Type:    protocol.TransferError,
+		Payload: payload,
+	}, crypt)
+}
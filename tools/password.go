@@ -2,47 +2,280 @@ package tools
 
 import (
 	"fmt"
+	"net"
+	"math"
+	"sort"
 	"regexp"
-	"math/rand"
+	"strconv"
+	"strings"
+	"math/big"
 	"encoding/hex"
 	"crypto/sha256"
+	crand "crypto/rand"
 
 	"github.com/abdfnx/tran/data"
 	"github.com/abdfnx/tran/models"
 )
 
-const passwordLength = 4
+const (
+	// DefaultPasswordWords is the number of words of a password if it is not configured.
+	DefaultPasswordWords = 3
+	MinPasswordWords     = 2
+	MaxPasswordWords     = 10
+)
+
+// CustomPasswordSeparator separates the id from the words of a password made by CustomPassword,
+// it tells the receiver that the words were chosen by the sender and are not corrected or looked up in the wordlists.
+const CustomPasswordSeparator = "+"
+
+var (
+	passwordFormat       = regexp.MustCompile(`^\d+(-[a-z]+)+$`)
+	customPasswordFormat = regexp.MustCompile(`^\d+\+[a-z]+(-[a-z]+)*$`)
+)
+
+// knownWords holds the words of all wordlists.
+var knownWords = wordSet()
+
+func wordSet() map[string]bool {
+	words := map[string]bool{}
+
+	for _, wordlist := range data.Wordlists {
+		for _, word := range wordlist {
+			words[word] = true
+		}
+	}
+
+	for _, word := range data.Legacy {
+		words[word] = true
+	}
+
+	return words
+}
+
+// Wordlist returns the words of the named wordlist, the default one if name is empty.
+func Wordlist(name string) ([]string, error) {
+	if name == "" {
+		name = data.DefaultWordlist
+	}
 
-// GeneratePassword generates a random password prefixed with the supplied id.
-func GeneratePassword(id int) models.Password {
-	var words []string
-	hitlistSize := len(data.PasswordList)
+	words, ok := data.Wordlists[name]
+	if !ok {
+		names := make([]string, 0, len(data.Wordlists))
+		for listName := range data.Wordlists {
+			names = append(names, listName)
+		}
+
+		sort.Strings(names)
+
+		return nil, fmt.Errorf("unknown wordlist %q, choose one of: %s", name, strings.Join(names, ", "))
+	}
+
+	return words, nil
+}
+
+// ValidatePasswordOptions reports whether passwords can be generated with options.
+func ValidatePasswordOptions(options models.PasswordOptions) error {
+	if options.Words != 0 && (options.Words < MinPasswordWords || options.Words > MaxPasswordWords) {
+		return fmt.Errorf("passwords must have between %d and %d words, not %d", MinPasswordWords, MaxPasswordWords, options.Words)
+	}
+
+	if _, err := Wordlist(options.Wordlist); err != nil {
+		return err
+	}
+
+	if options.Phrase != "" {
+		return ValidatePhrase(options.Phrase)
+	}
+
+	return nil
+}
 
-	// generate three unique words
-	for len(words) != passwordLength {
-		candidateWord := data.PasswordList[rand.Intn(hitlistSize)]
-		if !Contains(words, candidateWord) {
+// passwordWords returns the number of words of the passwords generated with options.
+func passwordWords(options models.PasswordOptions) int {
+	if options.Words == 0 {
+		return DefaultPasswordWords
+	}
+
+	return options.Words
+}
+
+// GeneratePassword generates a random password of distinct words from the configured wordlist, prefixed with the supplied id.
+// The password is made of the phrase of options instead if there is one, see CustomPassword.
+func GeneratePassword(id int, options models.PasswordOptions) (models.Password, error) {
+	if err := ValidatePasswordOptions(options); err != nil {
+		return "", err
+	}
+
+	if options.Phrase != "" {
+		return CustomPassword(id, options.Phrase)
+	}
+
+	wordlist, _ := Wordlist(options.Wordlist)
+	words := make([]string, 0, passwordWords(options))
+
+	for len(words) != cap(words) {
+		index, err := crand.Int(crand.Reader, big.NewInt(int64(len(wordlist))))
+		if err != nil {
+			return "", err
+		}
+
+		if candidateWord := wordlist[index.Int64()]; !Contains(words, candidateWord) {
 			words = append(words, candidateWord)
 		}
 	}
 
-	password := formatPassword(id, words)
-	return models.Password(password)
+	return models.Password(formatPassword(id, words)), nil
 }
 
+// PasswordEntropy estimates the entropy of the passwords generated with options in bits, not counting the id.
+func PasswordEntropy(options models.PasswordOptions) float64 {
+	if options.Phrase != "" {
+		return PhraseEntropy(options.Phrase)
+	}
+
+	wordlist, err := Wordlist(options.Wordlist)
+	if err != nil {
+		return 0
+	}
+
+	// the words are distinct
+	var entropy float64
+
+	for i := 0; i < passwordWords(options); i++ {
+		entropy += math.Log2(float64(len(wordlist) - i))
+	}
+
+	return entropy
+}
+
+// ParsePassword parses a password made by GeneratePassword or CustomPassword. The words of a generated password have to be
+// in one of the wordlists, or in the one of older versions, as the receiver does not know which wordlist the sender is configured with.
 func ParsePassword(passStr string) (models.Password, error) {
-	re := regexp.MustCompile(`^\d+-[a-z]+-[a-z]+-[a-z]+$`)
-	ok := re.MatchString(passStr)
+	if isCustomPassword(passStr) {
+		return parseCustomPassword(passStr)
+	}
 
-	if !ok {
+	if !passwordFormat.MatchString(passStr) {
+		return models.Password(""), fmt.Errorf("password: %q is on wrong format", passStr)
+	}
+
+	words := strings.Split(passStr, "-")[1:]
+	if len(words) < MinPasswordWords || len(words) > MaxPasswordWords {
+		return models.Password(""), fmt.Errorf("password: %q must have between %d and %d words", passStr, MinPasswordWords, MaxPasswordWords)
+	}
+
+	for _, word := range words {
+		if !knownWords[word] {
+			return models.Password(""), fmt.Errorf("password: %q contains %q, which is not a word of any wordlist", passStr, word)
+		}
+	}
+
+	return models.Password(passStr), nil
+}
+
+// parseCustomPassword parses a password made by CustomPassword, its words do not have to be in a wordlist as the sender chose them.
+func parseCustomPassword(passStr string) (models.Password, error) {
+	if !customPasswordFormat.MatchString(passStr) {
 		return models.Password(""), fmt.Errorf("password: %q is on wrong format", passStr)
 	}
 
+	_, phrase, _ := strings.Cut(passStr, CustomPasswordSeparator)
+	if words := strings.Split(phrase, "-"); len(words) < MinPasswordWords || len(words) > MaxPasswordWords {
+		return models.Password(""), fmt.Errorf("password: %q must have between %d and %d words", passStr, MinPasswordWords, MaxPasswordWords)
+	}
+
 	return models.Password(passStr), nil
 }
 
+// isCustomPassword reports whether passStr is a password made by CustomPassword rather than GeneratePassword.
+func isCustomPassword(passStr string) bool {
+	return strings.Contains(passStr, CustomPasswordSeparator)
+}
+
+const (
+	// MinPhraseEntropy is the estimated entropy in bits a phrase chosen by the sender must have at least.
+	MinPhraseEntropy = 24
+	// WeakPasswordEntropy is the estimated entropy in bits below which the sender is warned about the password.
+	WeakPasswordEntropy = 36
+
+	// a word chosen by a person is far less random than one drawn from the wordlists
+	chosenWordEntropy   = 11
+	chosenLetterEntropy = 2
+)
+
+var phraseWordFormat = regexp.MustCompile(`^[a-z]+$`)
+
+// phraseWords splits a phrase chosen by the sender into the words of the password.
+func phraseWords(phrase string) ([]string, error) {
+	words := codeFields(phrase)
+
+	if len(words) < MinPasswordWords || len(words) > MaxPasswordWords {
+		return nil, fmt.Errorf("the code must have between %d and %d words, not %d", MinPasswordWords, MaxPasswordWords, len(words))
+	}
+
+	for _, word := range words {
+		if !phraseWordFormat.MatchString(word) {
+			return nil, fmt.Errorf("the code may only contain the letters a to z, not in %q", word)
+		}
+	}
+
+	return words, nil
+}
+
+// PhraseEntropy estimates the entropy of a phrase chosen by the sender in bits, it is zero if the phrase can not be used.
+// Words of the wordlists count as much as any chosen word, other words by their letters, repeated words count once.
+func PhraseEntropy(phrase string) float64 {
+	words, err := phraseWords(phrase)
+	if err != nil {
+		return 0
+	}
+
+	var entropy float64
+	counted := map[string]bool{}
+
+	for _, word := range words {
+		if counted[word] {
+			continue
+		}
+
+		counted[word] = true
+
+		if knownWords[word] {
+			entropy += chosenWordEntropy
+		} else {
+			entropy += math.Min(chosenWordEntropy*2, float64(len(word)*chosenLetterEntropy))
+		}
+	}
+
+	return entropy
+}
+
+// ValidatePhrase reports whether a phrase chosen by the sender can be used as password, see MinPhraseEntropy.
+func ValidatePhrase(phrase string) error {
+	if _, err := phraseWords(phrase); err != nil {
+		return err
+	}
+
+	if entropy := PhraseEntropy(phrase); entropy < MinPhraseEntropy {
+		return fmt.Errorf("the code is too easy to guess (~%.0f bits of entropy, at least %d are needed), add more or longer words", entropy, MinPhraseEntropy)
+	}
+
+	return nil
+}
+
+// CustomPassword returns the password made of a phrase chosen by the sender, prefixed with the supplied id and CustomPasswordSeparator.
+func CustomPassword(id int, phrase string) (models.Password, error) {
+	if err := ValidatePhrase(phrase); err != nil {
+		return "", err
+	}
+
+	words, _ := phraseWords(phrase)
+
+	return models.Password(fmt.Sprintf("%d%s%s", id, CustomPasswordSeparator, strings.Join(words, "-"))), nil
+}
+
 func formatPassword(prefixIndex int, words []string) string {
-	return fmt.Sprintf("%d-%s-%s-%s", prefixIndex, words[0], words[1], words[2])
+	return fmt.Sprintf("%d-%s", prefixIndex, strings.Join(words, "-"))
 }
 
 func HashPassword(password models.Password) string {
@@ -51,3 +284,47 @@ func HashPassword(password models.Password) string {
 
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// RelayCode appends the address of the tranx server the sender uses to password,
+// so the receiver does not need to know it.
+func RelayCode(password models.Password, host string, port int) string {
+	return fmt.Sprintf("%s@%s", password, net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// ParseCode parses a bare password, a code made by RelayCode or a link made by ShareLink,
+// the host of the tranx server is empty if the code does not contain it.
+func ParseCode(code string) (password models.Password, host string, port int, err error) {
+	code = strings.TrimSpace(code)
+	if IsLink(code) {
+		return parseLink(code)
+	}
+
+	passStr, address, hasAddress := strings.Cut(code, "@")
+
+	password, err = ParsePassword(passStr)
+	if err != nil || !hasAddress {
+		return password, "", 0, err
+	}
+
+	host, port, err = ParseRelay(address)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("code: %q has an invalid tranx address: %w", code, err)
+	}
+
+	return password, host, port, nil
+}
+
+// ParseRelay parses the host:port address of a tranx server.
+func ParseRelay(address string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, err
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("%q has an invalid port", address)
+	}
+
+	return host, port, nil
+}
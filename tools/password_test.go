@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/abdfnx/tran/models"
+)
+
+func TestParsePassword(t *testing.T) {
+	tests := []struct {
+		password string
+		ok       bool
+	}{
+		{"1-gamma-ray-quasar", true},
+		{"12-purple-elephant", true},
+		{"1-gamma-ray-zqxwvy", false},
+		{"1-gamma", false},
+		{"gamma-ray-quasar", false},
+		{"1+purple-elephant-bananna", true},
+		{"1+zqxwvy-qqq", true},
+		{"1+zqxwvy", false},
+		{"1+purple+elephant", false},
+		{"+purple-elephant", false},
+		{"1+Purple-elephant", false},
+	}
+
+	for _, test := range tests {
+		got, err := ParsePassword(test.password)
+		if (err == nil) != test.ok {
+			t.Errorf("ParsePassword(%q) error = %v, want ok %v", test.password, err, test.ok)
+			continue
+		}
+
+		if test.ok && string(got) != test.password {
+			t.Errorf("ParsePassword(%q) = %q", test.password, got)
+		}
+	}
+}
+
+func TestCustomPasswordIsParsed(t *testing.T) {
+	password, err := CustomPassword(7, "Purple Elephant Bananna")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if password != "7+purple-elephant-bananna" {
+		t.Fatalf("CustomPassword = %q, want 7+purple-elephant-bananna", password)
+	}
+
+	got, host, _, err := ParseCode(CorrectCode(RelayCode(password, "relay.test", 8080)))
+	if err != nil || got != password || host != "relay.test" {
+		t.Errorf("ParseCode = %q, %q, %v, want %q on relay.test", got, host, err, password)
+	}
+}
+
+func TestGeneratedPasswordIsParsed(t *testing.T) {
+	for _, wordlist := range []string{"", "english"} {
+		password, err := GeneratePassword(3, models.PasswordOptions{Wordlist: wordlist})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ParsePassword(string(password)); err != nil {
+			t.Errorf("ParsePassword(%q): %v", password, err)
+		}
+	}
+}
+
+func TestCorrectCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"1-purple-elephant-bananna", "1-purple-elephant-banana"},
+		{" 1 Purple Elephant banana ", "1-purple-elephant-banana"},
+		{"1-gamma-ray-quasar@relay.test:8080", "1-gamma-ray-quasar@relay.test:8080"},
+		{"1+Purple Elephant Bananna", "1+purple-elephant-bananna"},
+		{"1 + purple bananna", "1+purple-bananna"},
+		{"tran://relay.test:8080/1-purple-bananna", "tran://relay.test:8080/1-purple-bananna"},
+	}
+
+	for _, test := range tests {
+		if got := CorrectCode(test.code); got != test.want {
+			t.Errorf("CorrectCode(%q) = %q, want %q", test.code, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"sync"
+	"runtime"
+)
+
+// Pipeline transforms chunks on a worker per core at once and hands them on in the order they were pushed.
+// Every chunk passes the stages of the pipeline in turn, like compression and then encryption.
+// It holds two chunks per worker at most, Push blocks until the oldest one was taken with Next.
+// One goroutine pushes the chunks and closes the input, another one takes them.
+type Pipeline struct {
+	stages    []Stage
+	jobs      chan *Chunk
+	ordered   chan *Chunk
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// Stage is a step of a Pipeline, it may be called for several chunks at once.
+type Stage func([]byte) ([]byte, error)
+
+// Chunk is a chunk pushed to a Pipeline.
+type Chunk struct {
+	in   []byte
+	out  []byte
+	err  error
+	done chan struct{}
+}
+
+// Len returns the length of the chunk before it was transformed.
+func (c *Chunk) Len() int {
+	return len(c.in)
+}
+
+// Result waits for the chunk to be transformed and returns the result.
+func (c *Chunk) Result() ([]byte, error) {
+	<-c.done
+
+	return c.out, c.err
+}
+
+func NewPipeline(stages ...Stage) *Pipeline {
+	workers := runtime.NumCPU()
+
+	p := &Pipeline{
+		stages:    stages,
+		jobs:      make(chan *Chunk),
+		ordered:   make(chan *Chunk, 2 * workers),
+		stop:      make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+func (p *Pipeline) work() {
+	for chunk := range p.jobs {
+		chunk.out = chunk.in
+
+		for _, stage := range p.stages {
+			if chunk.out, chunk.err = stage(chunk.out); chunk.err != nil {
+				break
+			}
+		}
+
+		close(chunk.done)
+	}
+}
+
+// Push adds data to the pipeline, it returns nil once the pipeline is stopped.
+func (p *Pipeline) Push(data []byte) *Chunk {
+	chunk := &Chunk{in: data, done: make(chan struct{})}
+
+	select {
+		case p.ordered <- chunk:
+
+		case <-p.stop:
+			return nil
+	}
+
+	p.jobs <- chunk
+
+	return chunk
+}
+
+// CloseInput tells that no further chunks are pushed.
+func (p *Pipeline) CloseInput() {
+	close(p.ordered)
+	close(p.jobs)
+}
+
+// Next returns the oldest chunk that was not taken yet, it reports false once the input is closed and all chunks were taken.
+func (p *Pipeline) Next() (*Chunk, bool) {
+	chunk, ok := <-p.ordered
+
+	return chunk, ok
+}
+
+// Stop stops taking chunks, Push does not block from then on.
+func (p *Pipeline) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+}
+
+// Stopped reports whether Stop was called.
+func (p *Pipeline) Stopped() bool {
+	select {
+		case <-p.stop:
+			return true
+
+		default:
+			return false
+	}
+}
@@ -1,21 +1,157 @@
 package tools
 
-import "net"
+import (
+	"fmt"
+	"net"
+	"errors"
+	"strconv"
 
-func GetOpenPort() (int, error) {
-	addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
+	"github.com/abdfnx/tran/models"
+)
 
+// ListenDirect listens for direct connections on the first free port of the range and the address or interface of policy.
+func ListenDirect(policy models.Direct) (net.Listener, error) {
+	host, err := bindHost(policy.Bind)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	listener, err := net.ListenTCP("tcp", addr)
+	first, last, err := policy.PortRange()
+	if err != nil {
+		return nil, err
+	}
+
+	for port := first; port <= last; port++ {
+		listener, listenErr := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if listenErr == nil {
+			return listener, nil
+		}
+
+		err = listenErr
+	}
+
+	return nil, fmt.Errorf("no port to listen on for direct connections: %w", err)
+}
 
+// bindHost returns the address to listen on for bind, which is an address or the name of an interface.
+func bindHost(bind string) (string, error) {
+	if bind == "" || net.ParseIP(bind) != nil {
+		return bind, nil
+	}
+
+	iface, err := net.InterfaceByName(bind)
+	if err != nil {
+		return "", fmt.Errorf("invalid bind address or interface %q: %w", bind, err)
+	}
+
+	addrs, err := iface.Addrs()
 	if err != nil {
-		return 0, err
+		return "", err
 	}
 
-	defer listener.Close()
+	// prefer IPv4, link-local addresses need a zone to be listened on
+	var host string
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP.String(), nil
+		}
+
+		if host == "" {
+			host = ipNet.IP.String()
+		}
+	}
+
+	if host == "" {
+		return "", fmt.Errorf("interface %q has no usable address", bind)
+	}
+
+	return host, nil
+}
+
+// ListenerCandidates returns the addresses other computers may reach listener at,
+// the bound address only, or the CandidateIPs if it listens on all addresses.
+func ListenerCandidates(listener net.Listener, preferred net.IP) []net.IP {
+	tcpAddr, _ := listener.Addr().(*net.TCPAddr)
+	if !tcpAddr.IP.IsUnspecified() {
+		return []net.IP{tcpAddr.IP}
+	}
+
+	return CandidateIPs(preferred)
+}
+
+// OutboundIP returns the IP address other computers on the network reach this one at,
+// the first usable interface address is used if there is no default route.
+func OutboundIP() (net.IP, error) {
+	// dialing UDP picks the interface of the default route without sending anything
+	if conn, err := net.Dial("udp4", "192.0.2.1:9"); err == nil {
+		defer conn.Close()
+
+		return conn.LocalAddr().(*net.UDPAddr).IP, nil
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+	}
+
+	return nil, errors.New("no network interface with an IP address found")
+}
+
+// CandidateIPs returns the addresses other computers may reach this one at, starting with preferred if it is set.
+// Loopback and link-local addresses are left out, unless preferred is one of them.
+func CandidateIPs(preferred net.IP) []net.IP {
+	var candidates []net.IP
+
+	if preferred != nil {
+		candidates = append(candidates, preferred)
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return candidates
+	}
+
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() || containsIP(candidates, ipNet.IP) {
+				continue
+			}
+
+			candidates = append(candidates, ipNet.IP)
+		}
+	}
+
+	return candidates
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, candidate := range ips {
+		if candidate.Equal(ip) {
+			return true
+		}
+	}
 
-	return listener.Addr().(*net.TCPAddr).Port, nil
+	return false
 }
@@ -0,0 +1,85 @@
+package tools
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"strings"
+	"net/url"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyVariables name the proxy for outgoing connections in the environment, in order of precedence.
+var proxyVariables = []string{"HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy", "HTTP_PROXY", "http_proxy"}
+
+// TranxDialer returns the dialer for connections to the tranx server, see ProxyFunc.
+func TranxDialer(proxy string) *websocket.Dialer {
+	return &websocket.Dialer{
+		Proxy:            ProxyFunc(proxy),
+		HandshakeTimeout: 45 * time.Second,
+	}
+}
+
+// ProxyFunc returns the Proxy function of a websocket.Dialer that connects through proxy if it is set,
+// or else through the proxy of the environment, unless NO_PROXY excludes the host.
+// Connections to loopback addresses are never proxied.
+func ProxyFunc(proxy string) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		config := httpproxy.Config{}
+		chosen := proxy
+
+		if chosen == "" {
+			chosen = lookupEnv(proxyVariables...)
+			config.NoProxy = lookupEnv("NO_PROXY", "no_proxy")
+		}
+
+		if chosen == "" {
+			return nil, nil
+		}
+
+		proxyURL, err := ParseProxy(chosen)
+		if err != nil {
+			return nil, err
+		}
+
+		// the connection is tunneled the same way for either scheme
+		config.HTTPProxy = proxyURL.String()
+		config.HTTPSProxy = proxyURL.String()
+
+		return config.ProxyFunc()(req.URL)
+	}
+}
+
+// ParseProxy parses the URL of an HTTP CONNECT or SOCKS5 proxy, a proxy without a scheme is an HTTP one.
+func ParseProxy(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %w", err)
+	}
+
+	switch proxyURL.Scheme {
+		case "http", "socks5", "socks5h":
+			return proxyURL, nil
+
+		default:
+			return nil, fmt.Errorf("invalid proxy %q: the scheme must be http, socks5 or socks5h", proxy)
+	}
+}
+
+// lookupEnv returns the value of the first of the variables that is set.
+func lookupEnv(variables ...string) string {
+	for _, variable := range variables {
+		if value := os.Getenv(variable); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
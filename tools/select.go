@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"path/filepath"
+)
+
+// MatchesAny reports whether the archived file name or one of its directories matches one of the glob patterns,
+// like logs/*.txt, see path.Match. Every name matches if there are no patterns.
+func MatchesAny(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	name = strings.TrimSuffix(filepath.ToSlash(name), "/")
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+
+		// a matching directory selects every file inside it
+		for dir := name; dir != "." && dir != "/" && dir != ""; dir = path.Dir(dir) {
+			if matched, _ := path.Match(pattern, dir); matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ValidatePatterns returns an error if one of the glob patterns is malformed.
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(filepath.ToSlash(pattern), ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// QuoteGlob escapes the special characters of a glob pattern in name, so that it matches just name.
+func QuoteGlob(name string) string {
+	var quoted strings.Builder
+
+	for _, r := range name {
+		if strings.ContainsRune(`*?[\`, r) {
+			quoted.WriteRune('\\')
+		}
+
+		quoted.WriteRune(r)
+	}
+
+	return quoted.String()
+}
@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"path"
+	"strings"
+	"path/filepath"
+)
+
+// Sink stores the files of a received payload, name is the slash separated name of a file in the archive.
+type Sink interface {
+	// MkdirAll creates the directory name along with its parents.
+	MkdirAll(name string) error
+
+	// Create creates or replaces the file name with mode, its parent directory exists already.
+	Create(name string, mode os.FileMode) (io.WriteCloser, error)
+}
+
+// dirSink stores the files below a directory of the file system.
+type dirSink struct {
+	dir string
+}
+
+// DirSink returns the Sink that stores the files below dir, the current working directory if dir is empty.
+func DirSink(dir string) Sink {
+	return &dirSink{dir: dir}
+}
+
+func (s *dirSink) MkdirAll(name string) error {
+	target, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	return os.MkdirAll(target, 0755)
+}
+
+func (s *dirSink) Create(name string, mode os.FileMode) (io.WriteCloser, error) {
+	target, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+}
+
+// path returns the path of the file name below the directory, names that would leave it are rejected.
+func (s *dirSink) path(name string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+
+	dir := s.dir
+	if dir == "" {
+		dir = "."
+	}
+
+	target := filepath.Join(dir, filepath.FromSlash(name))
+
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q is not below %s", name, dir)
+	}
+
+	return target, nil
+}
+
+// checkName returns an error if the name of a file in the archive could leave the directory the payload is expanded into:
+// absolute names, names with .. elements and names that are not slash separated.
+func checkName(name string) error {
+	clean := path.Clean(name)
+	native := filepath.FromSlash(clean)
+
+	switch {
+		case name == "" || strings.ContainsAny(name, "\\\x00"):
+			return fmt.Errorf("the archive contains the invalid name %q", name)
+
+		case path.IsAbs(clean) || filepath.IsAbs(native) || filepath.VolumeName(native) != "":
+			return fmt.Errorf("the archive contains the absolute name %q", name)
+
+		case clean == ".." || strings.HasPrefix(clean, "../"):
+			return fmt.Errorf("the archive contains %q, which is not below the directory it is expanded into", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package tools
+
+import (
+	"strings"
+	"net/http"
+	"crypto/rand"
+	"encoding/hex"
+	"crypto/subtle"
+)
+
+const (
+	tokenSize    = 32
+	bearerPrefix = "Bearer "
+)
+
+// GenerateToken generates a random secret for authenticating a single connection.
+func GenerateToken() (string, error) {
+	token := make([]byte, tokenSize)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
+
+// TokenHeader returns the header presenting token when dialing.
+func TokenHeader(token string) http.Header {
+	return http.Header{"Authorization": []string{bearerPrefix + token}}
+}
+
+// HasToken reports whether the request presents token, an empty token is never presented.
+func HasToken(r *http.Request, token string) bool {
+	presented := strings.TrimPrefix(r.Header.Get("Authorization"), bearerPrefix)
+
+	return token != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1
+}
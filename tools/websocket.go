@@ -1,7 +1,13 @@
 package tools
 
 import (
+	"fmt"
 	"log"
+	"net"
+	"sync"
+	"time"
+	"context"
+	"strconv"
 	"net/http"
 
 	"github.com/gorilla/websocket"
@@ -25,3 +31,103 @@ func WebsocketHandler(wsHandler WsHandlerFunc) http.HandlerFunc {
 		wsHandler(wsConn)
 	}
 }
+
+// SetDeadline sets the read and write deadline of the connection to timeout from now, zero clears the deadline.
+func SetDeadline(wsConn *websocket.Conn, timeout time.Duration) {
+	var deadline time.Time
+
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	wsConn.SetReadDeadline(deadline)
+	wsConn.SetWriteDeadline(deadline)
+}
+
+// OnDone calls f once ctx is done, until the returned stop function is called.
+func OnDone(ctx context.Context, f func()) (stop func()) {
+	stopCh := make(chan struct{})
+
+	go func() {
+		select {
+			case <-ctx.Done():
+				f()
+
+			case <-stopCh:
+		}
+	}()
+
+	return func() {
+		close(stopCh)
+	}
+}
+
+// candidateDelay is the head start of every candidate address over the next one.
+const candidateDelay = 250 * time.Millisecond
+
+// DialCandidates dials the websocket endpoint at path with header on every candidate address, each shortly after the previous one
+// (happy eyeballs), and retries them until ctx is done. The first established connection wins, the others are closed.
+func DialCandidates(ctx context.Context, ips []net.IP, port int, path string, header http.Header) (*websocket.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	connCh := make(chan *websocket.Conn)
+	var wg sync.WaitGroup
+
+	for i, ip := range ips {
+		wg.Add(1)
+
+		go func(delay time.Duration, ip net.IP) {
+			defer wg.Done()
+
+			address := fmt.Sprintf("ws://%s%s", net.JoinHostPort(ip.String(), strconv.Itoa(port)), path)
+			wsConn := dialWithBackoff(ctx, delay, address, header)
+			if wsConn == nil {
+				return
+			}
+
+			select {
+				case connCh <- wsConn:
+
+				case <-ctx.Done():
+					wsConn.Close()
+			}
+		}(time.Duration(i)*candidateDelay, ip)
+	}
+
+	go func() {
+		wg.Wait()
+		close(connCh)
+	}()
+
+	wsConn, ok := <-connCh
+	if !ok {
+		return nil, fmt.Errorf("could not connect to any of %d addresses", len(ips))
+	}
+
+	return wsConn, nil
+}
+
+// dialWithBackoff waits for delay and then dials address with exponential backoff until ctx is done.
+func dialWithBackoff(ctx context.Context, delay time.Duration, address string, header http.Header) *websocket.Conn {
+	d := 250 * time.Millisecond
+
+	for {
+		select {
+			case <-ctx.Done():
+				return nil
+
+			case <-time.After(delay):
+		}
+
+		dialer := websocket.Dialer{HandshakeTimeout: d}
+		wsConn, _, err := dialer.DialContext(ctx, address, header)
+
+		if err == nil {
+			return wsConn
+		}
+
+		delay = d
+		d = d * 2
+	}
+}